@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"surf/pkg/ogg"
+)
+
+// runOgg runs the ogg subcommands which are used to diagnose tracks
+func runOgg(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: surf ogg inspect [-summary] <file>")
+	}
+
+	switch args[0] {
+	case "inspect":
+		return inspectOgg(args[1:], os.Stdout)
+	default:
+		return fmt.Errorf("unknown ogg command: %s", args[0])
+	}
+}
+
+// inspectOgg dumps every page of the ogg file, or only
+// the summary of the file if the -summary flag is given
+func inspectOgg(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("surf ogg inspect", flag.ContinueOnError)
+	summary := fs.Bool("summary", false, "only print the summary of the file")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: surf ogg inspect [-summary] <file>")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var fn func(ogg.PageInfo) error
+	if !*summary {
+		fmt.Fprintf(w, pageFormat, "OFFSET", "SERIAL", "SEQ", "FLAGS", "GRANULE", "TIME", "SEGS", "CRC", "PACKETS")
+		fn = func(p ogg.PageInfo) error {
+			return writePage(w, p)
+		}
+	}
+	s, err := ogg.Inspect(f, fn)
+	if err != nil {
+		return err
+	}
+	if !*summary {
+		fmt.Fprintln(w)
+	}
+	writeSummary(w, s)
+	return nil
+}
+
+// pageFormat lays out each page as a row of the table
+const pageFormat = "%-10s %-8s %-6s %-12s %-12s %-14s %-4s %-3s %s\n"
+
+func writePage(w io.Writer, p ogg.PageInfo) error {
+	granule, timestamp := "-", "-"
+	if p.HasGranule {
+		granule = fmt.Sprint(p.Granule)
+	}
+	if p.HasTime {
+		timestamp = p.Time.String()
+	}
+	crc := "ok"
+	if !p.ValidCRC {
+		crc = "BAD"
+	}
+
+	_, err := fmt.Fprintf(w, pageFormat, fmt.Sprint(p.Offset), fmt.Sprintf("%08x", p.Serial), fmt.Sprint(p.Sequence),
+		p.Flags, granule, timestamp, fmt.Sprint(p.Segments), crc, packetSizes(p))
+	if err != nil {
+		return err
+	}
+	if p.Version != 0 {
+		fmt.Fprintf(w, "  unknown ogg version: %d\n", p.Version)
+	}
+	if p.Head != nil {
+		writeHead(w, *p.Head)
+	}
+	if p.Tags != nil {
+		writeTags(w, *p.Tags)
+	}
+	return nil
+}
+
+// packetSizes lists the sizes of the packets on the page, runs of packets with
+// the same size are shortened to size*count and a packet which continues
+// onto the next page is marked with a +
+func packetSizes(p ogg.PageInfo) string {
+	var sizes []string
+	for i := 0; i < len(p.Packets); {
+		j := i + 1
+		for j < len(p.Packets) && p.Packets[j] == p.Packets[i] && !(p.Continues && j == len(p.Packets)-1) {
+			j++
+		}
+		size := fmt.Sprint(p.Packets[i])
+		if j-i > 1 {
+			size += fmt.Sprintf("*%d", j-i)
+		}
+		sizes = append(sizes, size)
+		i = j
+	}
+	if p.Continues {
+		sizes[len(sizes)-1] += "+"
+	}
+	return strings.Join(sizes, " ")
+}
+
+func writeHead(w io.Writer, h ogg.OpusHead) {
+	fmt.Fprintf(w, "  OpusHead: version %d, %d channels, pre-skip %d, input rate %d Hz, gain %.2f dB, mapping family %d\n",
+		h.Version, h.Channels, h.PreSkip, h.InputSampleRate, h.Gain(), h.MappingFamily)
+}
+
+func writeTags(w io.Writer, t ogg.OpusTags) {
+	fmt.Fprintf(w, "  OpusTags: vendor %q\n", t.Vendor)
+	for _, c := range t.Comments {
+		fmt.Fprintf(w, "    %s\n", c)
+	}
+}
+
+func writeSummary(w io.Writer, s ogg.InspectSummary) {
+	fmt.Fprintf(w, "Size: %d bytes\n", s.Size)
+	fmt.Fprintf(w, "Pages: %d (%d corrupt)\n", s.Pages, s.CorruptPages)
+	fmt.Fprintf(w, "Skipped: %d bytes\n", s.SkippedBytes)
+	if s.Truncated {
+		fmt.Fprintln(w, "Truncated: the last page is incomplete")
+	}
+	for _, st := range s.Streams {
+		fmt.Fprintf(w, "Stream %08x: %s\n", st.Serial, st.Duration)
+		writeHead(w, st.Info.Head)
+		writeTags(w, st.Info.Tags)
+	}
+	fmt.Fprintf(w, "Duration: %s\n", s.Duration)
+	fmt.Fprintf(w, "Bitrate: %.1f kbps\n", s.Bitrate()/1000)
+}
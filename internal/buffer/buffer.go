@@ -0,0 +1,210 @@
+// Package buffer provides an in-memory buffer which can be read
+// from whilst it is still being written to
+package buffer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+)
+
+var ErrClosed = errors.New("write to closed buffer")
+
+// Buffer holds data as it's written to it, readers block until the
+// data they want has been written or the buffer is closed
+type Buffer struct {
+	mu   sync.Mutex
+	data []byte
+	// base is the offset of data[0], the data before it has been
+	// discarded because it no longer fits in the window
+	base   int64
+	window int64
+	// done is set once no more data will be written,
+	// err is returned to readers if the writer failed
+	done bool
+	err  error
+	// notify is closed and replaced every time the buffer changes
+	notify chan struct{}
+}
+
+func New() *Buffer {
+	return &Buffer{notify: make(chan struct{})}
+}
+
+// NewWindow returns a buffer which only keeps roughly the last size bytes
+// written to it, it's meant for streams which never end. Readers which fall
+// behind the window skip ahead to the oldest data which is still kept
+func NewWindow(size int64) *Buffer {
+	return &Buffer{notify: make(chan struct{}), window: size}
+}
+
+// Write appends p to the buffer
+func (b *Buffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.done {
+		return 0, ErrClosed
+	}
+	b.data = append(b.data, p...)
+	// We let the buffer grow to twice the window so
+	// we don't have to move the data on every write
+	if b.window > 0 && int64(len(b.data)) > 2*b.window {
+		drop := int64(len(b.data)) - b.window
+		b.data = append(b.data[:0], b.data[drop:]...)
+		b.base += drop
+	}
+	b.broadcast()
+	return len(p), nil
+}
+
+// Close marks the buffer as complete
+func (b *Buffer) Close() error {
+	return b.CloseWithError(nil)
+}
+
+// CloseWithError marks the buffer as complete, readers receive
+// the error once they've read all the data which was written
+func (b *Buffer) CloseWithError(err error) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.done {
+		return nil
+	}
+	b.done = true
+	b.err = err
+	b.broadcast()
+	return nil
+}
+
+// Buffered returns how much data has been written
+// and whether the buffer is complete
+func (b *Buffer) Buffered() (n int64, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.base + int64(len(b.data)), b.done
+}
+
+// Wait blocks until at least n bytes have been written or the buffer is
+// closed. If the buffer failed before n bytes were written its error is returned
+func (b *Buffer) Wait(ctx context.Context, n int64) error {
+	for {
+		b.mu.Lock()
+		size, done, err, notify := b.base+int64(len(b.data)), b.done, b.err, b.notify
+		b.mu.Unlock()
+
+		if size >= n {
+			return nil
+		}
+		if done {
+			return err
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// waitDone blocks until the buffer is closed
+func (b *Buffer) waitDone(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		done, notify := b.done, b.notify
+		b.mu.Unlock()
+
+		if done {
+			return nil
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// NewReader returns a reader which starts at the beginning of
+// the buffer, it stops blocking once the ctx is cancelled
+func (b *Buffer) NewReader(ctx context.Context) *Reader {
+	return &Reader{b: b, ctx: ctx}
+}
+
+// broadcast wakes up any waiting readers, the mutex must be held
+func (b *Buffer) broadcast() {
+	close(b.notify)
+	b.notify = make(chan struct{})
+}
+
+// Reader reads from a Buffer, it implements io.ReadSeeker
+type Reader struct {
+	b   *Buffer
+	ctx context.Context
+	off int64
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	err := r.b.Wait(r.ctx, r.off+1)
+	if err != nil {
+		return 0, err
+	}
+
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+
+	if r.off < r.b.base {
+		r.off = r.b.base
+	}
+	if r.off >= r.b.base+int64(len(r.b.data)) {
+		if r.b.err != nil {
+			return 0, r.b.err
+		}
+		return 0, io.EOF
+	}
+	n := copy(p, r.b.data[r.off-r.b.base:])
+	r.off += int64(n)
+	return n, nil
+}
+
+// Seek sets the offset of the next Read. Seeking relative to
+// the end waits until the buffer is complete since the end
+// isn't known until then
+func (r *Reader) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = r.off + offset
+	case io.SeekEnd:
+		err := r.b.waitDone(r.ctx)
+		if err != nil {
+			return r.off, err
+		}
+		size, _ := r.b.Buffered()
+		abs = size + offset
+	default:
+		return r.off, errors.New("invalid whence")
+	}
+	if abs < 0 {
+		return r.off, errors.New("negative position")
+	}
+	r.off = abs
+	return abs, nil
+}
+
+// Buffered returns how much data has been written to the
+// underlying buffer and whether it's complete
+func (r *Reader) Buffered() (n int64, complete bool) {
+	return r.b.Buffered()
+}
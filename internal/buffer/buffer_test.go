@@ -0,0 +1,87 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReadWhileWriting(t *testing.T) {
+	b := New()
+	r := b.NewReader(context.Background())
+
+	go func() {
+		for i := 0; i < 3; i++ {
+			time.Sleep(10 * time.Millisecond)
+			b.Write([]byte{byte(i)})
+		}
+		b.Close()
+	}()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 3 || data[0] != 0 || data[2] != 2 {
+		t.Errorf("invalid data read: %v", data)
+	}
+
+	// Seeking back should let us read the data again
+	_, err = r.Seek(1, io.SeekStart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = io.ReadAll(r)
+	if err != nil || len(data) != 2 {
+		t.Errorf("invalid data read after seeking: %v, %v", data, err)
+	}
+}
+
+func TestCloseWithError(t *testing.T) {
+	b := New()
+	b.Write([]byte("abc"))
+	errFailed := errors.New("failed")
+	b.CloseWithError(errFailed)
+
+	// The data should be read before the error is returned
+	data, err := io.ReadAll(b.NewReader(context.Background()))
+	if string(data) != "abc" || !errors.Is(err, errFailed) {
+		t.Errorf("expected data and error but got: %q, %v", data, err)
+	}
+}
+
+func TestCancelRead(t *testing.T) {
+	b := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := b.NewReader(ctx)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	_, err := r.Read(make([]byte, 1))
+	if err != context.Canceled {
+		t.Errorf("expected read to be cancelled but got: %v", err)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	b := NewWindow(4)
+	r := b.NewReader(context.Background())
+	b.Write([]byte("abcdefghi"))
+	b.Close()
+
+	// Old data is discarded and readers skip past it
+	if n, _ := b.Buffered(); n != 9 {
+		t.Errorf("expected 9 bytes to be buffered but got %d", n)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "fghi" {
+		t.Errorf("invalid data read: %q", data)
+	}
+}
@@ -0,0 +1,164 @@
+package sync
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the time, it's used so that code which waits
+// can be driven by a FakeClock when testing
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+	// NewTimer returns a Timer which fires once the duration has elapsed
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer sends the current time on its channel once it fires
+type Timer interface {
+	C() <-chan time.Time
+	// Stop prevents the timer from firing, it returns
+	// false if the timer has already fired
+	Stop() bool
+}
+
+// RealClock is a Clock which uses the system time
+type RealClock struct{}
+
+func (RealClock) Now() time.Time {
+	return time.Now()
+}
+
+func (RealClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	t *time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.t.C
+}
+
+func (t realTimer) Stop() bool {
+	return t.t.Stop()
+}
+
+// FakeClock is a Clock whose time only moves when it's advanced, it's
+// used to test code which waits without having to sleep
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	auto    bool
+	waiters []*fakeTimer
+	changed chan struct{}
+}
+
+// NewFakeClock returns a FakeClock set to the given time
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:     now,
+		changed: make(chan struct{}),
+	}
+}
+
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{clock: c, deadline: c.now.Add(d), c: make(chan time.Time, 1)}
+	if c.auto && t.deadline.After(c.now) {
+		c.now = t.deadline
+	}
+	c.waiters = append(c.waiters, t)
+	c.fire()
+	return t
+}
+
+// SetAutoAdvance sets whether new timers advance the clock to their
+// deadline straight away, so waiting code runs as fast as possible
+func (c *FakeClock) SetAutoAdvance(auto bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.auto = auto
+}
+
+// Advance moves the clock forward, firing any waiters whose deadline has passed
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+	c.fire()
+}
+
+// BlockUntil waits until n timers are waiting to fire
+func (c *FakeClock) BlockUntil(n int) {
+	for {
+		c.mu.Lock()
+		waiting, changed := len(c.waiters), c.changed
+		c.mu.Unlock()
+
+		if waiting >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// fire sends the time to the waiters whose deadline has passed,
+// the lock must be held when calling it
+func (c *FakeClock) fire() {
+	waiters := c.waiters[:0]
+	for _, t := range c.waiters {
+		if t.deadline.After(c.now) {
+			waiters = append(waiters, t)
+			continue
+		}
+		t.c <- c.now
+	}
+	c.waiters = waiters
+	c.notify()
+}
+
+// notify wakes up anyone blocking on the number of waiters,
+// the lock must be held when calling it
+func (c *FakeClock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// fakeTimer is a Timer created by a FakeClock
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	c := t.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, w := range c.waiters {
+		if w == t {
+			c.waiters = append(c.waiters[:i], c.waiters[i+1:]...)
+			c.notify()
+			return true
+		}
+	}
+	return false
+}
@@ -1,55 +1,98 @@
 package sync
 
-import "sync"
+import (
+	"context"
+	"sync"
+	"time"
+)
 
 // Controller implements the ability to tell multiple goroutines
 // to wait or resume based on a pause condition. At appropriate times
-// goroutines should check if they should pause using the waitIfPaused()
+// goroutines should check if they should pause using the WaitIfPaused()
 // method.
 type Controller struct {
-	paused bool
-	cond   *sync.Cond
+	clock Clock
+
+	mu      sync.Mutex
+	paused  bool
+	waiting int
+	// resumed is closed when the controller is resumed
+	resumed chan struct{}
 }
 
 // NewController returns a new Controller to synchronise goroutines.
-// The Controller starts unpaused by default
-func NewController() *Controller {
+// The Controller starts unpaused by default, the clock is used to
+// measure how long goroutines were paused for
+func NewController(clock Clock) *Controller {
 	return &Controller{
-		paused: false,
-		cond:   sync.NewCond(&sync.Mutex{}),
+		clock:   clock,
+		resumed: make(chan struct{}),
 	}
 }
 
 // Paused returns whether the controller is currently pausing goroutines
 func (c *Controller) Paused() bool {
-	c.cond.L.Lock()
-	defer c.cond.L.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
 	return c.paused
 }
 
+// Waiting returns how many goroutines are currently paused
+func (c *Controller) Waiting() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.waiting
+}
+
 // Pause sets the controller to a paused state
 func (c *Controller) Pause() {
-	c.cond.L.Lock()
-	c.paused = true
-	c.cond.L.Unlock()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.paused {
+		c.paused = true
+		c.resumed = make(chan struct{})
+	}
 }
 
 // Resume wakes up all goroutines waiting on the controller
 // and continues their execution
 func (c *Controller) Resume() {
-	c.cond.L.Lock()
-	c.paused = false
-	c.cond.L.Unlock()
-	c.cond.Broadcast()
-}
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-// WaitIfPaused causes the goroutine to wait if it is paused,
-// until the Resume() function is called to continue execution
-func (c *Controller) WaitIfPaused() {
-	c.cond.L.Lock()
 	if c.paused {
-		c.cond.Wait()
+		c.paused = false
+		close(c.resumed)
+	}
+}
+
+// WaitIfPaused causes the goroutine to wait if it is paused, until the
+// Resume() function is called to continue execution or the ctx is
+// cancelled. It returns how long the goroutine was paused for
+func (c *Controller) WaitIfPaused(ctx context.Context) (time.Duration, error) {
+	c.mu.Lock()
+	if !c.paused {
+		c.mu.Unlock()
+		return 0, nil
+	}
+	resumed := c.resumed
+	c.waiting++
+	c.mu.Unlock()
+
+	start := c.clock.Now()
+	defer func() {
+		c.mu.Lock()
+		c.waiting--
+		c.mu.Unlock()
+	}()
+
+	select {
+	case <-resumed:
+		return c.clock.Now().Sub(start), nil
+	case <-ctx.Done():
+		return c.clock.Now().Sub(start), ctx.Err()
 	}
-	c.cond.L.Unlock()
 }
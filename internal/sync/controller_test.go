@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	c := NewFakeClock(time.Time{})
+	a := c.NewTimer(time.Second)
+	b := c.NewTimer(2 * time.Second)
+
+	// Only the timers whose deadline has passed should fire
+	c.Advance(time.Second)
+	select {
+	case <-a.C():
+	default:
+		t.Error("timer did not fire")
+	}
+	select {
+	case <-b.C():
+		t.Error("timer fired early")
+	default:
+	}
+
+	// Stopped timers never fire
+	if !b.Stop() {
+		t.Error("failed to stop the timer")
+	}
+	c.Advance(time.Minute)
+	select {
+	case <-b.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	if c.Now() != (time.Time{}).Add(time.Minute+time.Second) {
+		t.Errorf("invalid time: %s", c.Now())
+	}
+}
+
+func TestController(t *testing.T) {
+	clock := NewFakeClock(time.Time{})
+	c := NewController(clock)
+
+	// Unpaused controllers don't wait
+	if d, err := c.WaitIfPaused(context.Background()); d != 0 || err != nil {
+		t.Errorf("waited for %s: %v", d, err)
+	}
+
+	// The time spent paused is measured with the clock
+	c.Pause()
+	waited := make(chan time.Duration)
+	go func() {
+		d, err := c.WaitIfPaused(context.Background())
+		if err != nil {
+			t.Error(err)
+		}
+		waited <- d
+	}()
+	for c.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(3 * time.Second)
+	c.Resume()
+	if d := <-waited; d != 3*time.Second {
+		t.Errorf("paused for %s instead of 3s", d)
+	}
+
+	// Waiting can be cancelled
+	c.Pause()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.WaitIfPaused(ctx); err != context.Canceled {
+		t.Errorf("expected the wait to be cancelled: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"os/exec"
 
@@ -8,20 +9,47 @@ import (
 	"github.com/rs/zerolog/log"
 
 	"surf/pkg/surf"
+	ytdlp "surf/pkg/yt-dlp"
 )
 
-func mustExec(path string) {
+// mustExec ensures the binary exists, it defaults to the name if no path is given
+func mustExec(path, name string) {
+	if path == "" {
+		path = name
+	}
 	_, err := exec.LookPath(path)
 	if err != nil {
-		log.Fatal().Err(err).Msg("no " + path + " found")
+		log.Fatal().Err(err).Msg("no " + name + " found")
+	}
+}
+
+func runCommand(cmd string, args []string) error {
+	switch cmd {
+	case "ogg":
+		return runOgg(args)
+	default:
+		return fmt.Errorf("unknown command: %s", cmd)
 	}
 }
 
 func main() {
-	mustExec("yt-dlp")
-	mustExec("ffmpeg")
+	// Subcommands are used for diagnostics, no args runs the bot
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1], os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	godotenv.Load()
+	cfg := ytdlp.ConfigFromEnv()
+
+	mustExec(cfg.YtdlpPath, "yt-dlp")
+	mustExec(cfg.FFmpegPath, "ffmpeg")
+	if cfg.LibraryDir != "" {
+		mustExec(cfg.FFprobePath, "ffprobe")
+	}
 
 	// Discord config
 	token := os.Getenv("BOT_TOKEN")
@@ -30,17 +58,15 @@ func main() {
 	}
 
 	// Spotify config
-	spotifyID := os.Getenv("SPOTIFY_ID")
-	if spotifyID == "" {
+	if cfg.SpotifyID == "" {
 		log.Warn().Msg("no $SPOTIFY_ID given - bot will not support spotify")
 	}
-	spotifySecret := os.Getenv("SPOTIFY_SECRET")
-	if spotifySecret == "" {
+	if cfg.SpotifySecret == "" {
 		log.Warn().Msg("no $SPOTIFY_SECRET given - bot will not support spotify")
 	}
 
 	// Run surf
-	if err := surf.Run(token, spotifyID, spotifySecret); err != nil {
+	if err := surf.Run(token, cfg); err != nil {
 		log.Fatal().Err(err).Msg("bot error")
 	}
 }
@@ -0,0 +1,41 @@
+package ogg
+
+// The ogg checksum is a CRC32 using the polynomial 0x04c11db7 with a zero
+// initial value and no bit reflection, so hash/crc32 cannot be used for it
+var crcTable = makeCRCTable(0x04c11db7)
+
+func makeCRCTable(poly uint32) *[256]uint32 {
+	var t [256]uint32
+	for i := range t {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = (r << 1) ^ poly
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return &t
+}
+
+// crcUpdate adds the bytes in p to the running checksum crc
+func crcUpdate(crc uint32, p []byte) uint32 {
+	for _, b := range p {
+		crc = (crc << 8) ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+// pageChecksum calculates the checksum of a full page, the checksum field
+// inside the header is treated as if it were zeroed
+func pageChecksum(header, segTbl, data []byte) uint32 {
+	var crc uint32
+	crc = crcUpdate(crc, header[:22])
+	crc = crcUpdate(crc, []byte{0, 0, 0, 0})
+	crc = crcUpdate(crc, header[26:])
+	crc = crcUpdate(crc, segTbl)
+	crc = crcUpdate(crc, data)
+	return crc
+}
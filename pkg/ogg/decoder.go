@@ -3,7 +3,7 @@
 // The code has been rewritten again by me (fiwippi)
 
 // Package ogg provides a decoder to unwrap opus frames into packets and to seek
-// whilst the decoder is running
+// whilst the decoder is running, and an encoder to wrap packets back into pages
 package ogg
 
 import (
@@ -12,224 +12,528 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sync/atomic"
 	"time"
 
 	"surf/internal/sync"
 )
 
-var test = false
+var (
+	// capturePattern marks the start of every ogg page
+	capturePattern = []byte{'O', 'g', 'g', 'S'}
+	// errCorruptPage is returned when a page fails validation
+	errCorruptPage = errors.New("corrupt ogg page")
+)
+
+// headerState tracks which of the opus header packets we expect next
+type headerState int
+
+const (
+	expectHead headerState = iota
+	expectTags
+	expectAudio
+)
+
+// seekRequest asks the decode loop to seek to the goal
+type seekRequest struct {
+	goal time.Duration
+	err  chan error
+}
+
+// run is the state of a single call to Decode
+type run struct {
+	// done is closed once the decode has finished
+	done chan struct{}
+}
+
+// growingReader is implemented by srcs which can still be written to
+// whilst they're being decoded, e.g. if the track is being downloaded
+type growingReader interface {
+	// Buffered returns how many bytes the src currently
+	// has and whether all of its data has been written
+	Buffered() (n int64, complete bool)
+}
+
+// cursor is where the decoder is in the src, it's saved
+// before seeking so the decoder can go back if it fails
+type cursor struct {
+	// offset is the current position of the decoder in the src
+	offset int64
+	// pos is the playback position in samples at the end of
+	// the last page which was decoded
+	pos uint64
+	// granule is the granule position of the last packet
+	// written, it's relative to the start of the link
+	granule uint64
+	// prev is the offset of the last page read from the opus stream
+	prev int64
+	// link is the index of the link being decoded, inBOS is
+	// set whilst reading the beginning of stream pages
+	link  int
+	inBOS bool
+	// headers is the next header packet expected from the stream
+	headers headerState
+}
 
 type Decoder struct {
+	cursor
+
 	// Controls decoding seeking so they don't happen concurrently
 	c *sync.Controller
-	// buffer holds the data we are reading from the src
-	buffer []byte
+	// buffer holds the data we are reading from the src, spare
+	// is swapped in whilst seeking so the current page is kept
+	buffer, spare []byte
 	// src is the reader which contains the ogg data
 	src io.ReadSeeker
-	// Time is updated with the current timestamp we are on when decoding
-	Time time.Duration
+	// seeks are carried out by the decode loop so the
+	// src is never read from by two goroutines
+	seeks chan seekRequest
+	// run is the decode which is currently in progress
+	run atomic.Pointer[run]
+	// links are the chained streams we have come across
+	links []link
+	// last and lastSerial describe the final page in the src,
+	// last is noGranule until it has been looked up
+	last       uint64
+	lastSerial uint32
+	// index records the offsets of pages we have come across
+	index index
+	// partial holds the start of a packet which continues onto the next
+	// page, continuing is set if the next page should finish the packet
+	partial    []byte
+	continuing bool
+	// info is parsed from the headers of the current link
+	info atomic.Pointer[StreamInfo]
+	// skippedBytes and skippedPages count the data discarded
+	// whilst resynchronising after corrupt or truncated pages
+	skippedBytes, skippedPages atomic.Int64
+	// playhead is the playback position at the end of the last packet written
+	playhead atomic.Int64
+	// clock paces the packets as they are written
+	clock sync.Clock
+	// subs receive the events emitted whilst decoding
+	subs subscribers
 }
 
 func NewDecoder() *Decoder {
+	return NewDecoderWithClock(sync.RealClock{})
+}
+
+// NewDecoderWithClock returns a decoder which paces
+// the packets it writes by the clock
+func NewDecoderWithClock(clock sync.Clock) *Decoder {
 	return &Decoder{
-		c:      sync.NewController(),
+		c:      sync.NewController(clock),
 		buffer: make([]byte, MaxPageSize),
+		spare:  make([]byte, MaxPageSize),
+		seeks:  make(chan seekRequest),
+		clock:  clock,
 	}
 }
 
 // Public
 
+// Decode writes the opus packets in the src to the dst until the src ends
+// or the ctx is cancelled. The src may still be growing, e.g. if it's being
+// downloaded, in which case decoding waits for the data as it needs it.
+// Chained streams are decoded one after the other and if a link has
+// multiple streams only the first opus stream is decoded
 func (d *Decoder) Decode(ctx context.Context, dst io.Writer, src io.ReadSeeker) error {
-	d.src = src
-	err := d.decode(ctx, dst)
-	if err == io.EOF {
+	r := &run{done: make(chan struct{})}
+	d.run.Store(r)
+	defer close(r.done)
+
+	err := d.reset(src)
+	if err != nil {
+		return err
+	}
+
+	err = d.decode(ctx, dst)
+	switch {
+	case err == io.EOF:
+		d.emit(EventEOF, nil)
+		return nil
+	case ctx.Err() != nil:
 		return nil
+	case err != nil:
+		d.emit(EventError, err)
 	}
 	return err
 }
 
+// Seek moves the decoder to the goal, resuming it if it's paused. If the
+// src is still growing and doesn't contain the goal yet then Seek waits
+// until the goal has been written to it
 func (d *Decoder) Seek(goal time.Duration) error {
-	d.Pause()
-	defer d.Resume()
+	r := d.run.Load()
+	if r == nil {
+		return nil
+	}
+	d.c.Resume()
 
-	if d.src == nil {
+	req := seekRequest{goal: goal, err: make(chan error, 1)}
+	select {
+	case d.seeks <- req:
+		return <-req.err
+	case <-r.done:
 		return nil
 	}
-	offset, err := d.seek(goal)
-	if err == io.EOF {
-		_, err = d.src.Seek(offset, io.SeekStart)
-		return err
+}
+
+// SeekRangeError is returned when seeking to a position which isn't in the track
+type SeekRangeError struct {
+	// Goal is the position which was requested
+	Goal time.Duration
+	// End is the furthest position which can be seeked to,
+	// the track can always be seeked to from the start
+	End time.Duration
+}
+
+func (e *SeekRangeError) Error() string {
+	return fmt.Sprintf("cannot seek to %s, position must be between 0s and %s", e.Goal, e.End)
+}
+
+// Skipped returns how many bytes and pages were discarded during the
+// last decode because they were corrupt or truncated
+func (d *Decoder) Skipped() (bytes, pages int64) {
+	return d.skippedBytes.Load(), d.skippedPages.Load()
+}
+
+// StreamInfo returns the info parsed from the headers of the stream being
+// decoded, ok is false if the headers haven't been decoded yet. For chained
+// streams this is the info of the current link
+func (d *Decoder) StreamInfo() (info StreamInfo, ok bool) {
+	i := d.info.Load()
+	if i == nil {
+		return StreamInfo{}, false
 	}
-	return err
+	return *i, true
+}
+
+// Time returns the playback position at the end of the last packet which was
+// written, it's advanced by the duration of every packet as it's written
+func (d *Decoder) Time() time.Duration {
+	return time.Duration(d.playhead.Load())
+}
+
+// Position returns how far through playback listeners are, packets are
+// written paceAhead before they're due so it's that far behind Time
+func (d *Decoder) Position() time.Duration {
+	pos := d.Time() - paceAhead
+	if pos < 0 {
+		return 0
+	}
+	return pos
 }
 
+// Pause stops the decoder before it writes the next packet
 func (d *Decoder) Pause() {
-	time.Sleep(1 * time.Second)
 	d.c.Pause()
 }
 
+// Resume continues decoding from the packet it was paused at
 func (d *Decoder) Resume() {
-	time.Sleep(1 * time.Second)
 	d.c.Resume()
 }
 
 // Private
 
+func (d *Decoder) reset(src io.ReadSeeker) error {
+	offset, err := src.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	d.src = src
+	d.cursor = cursor{offset: offset, prev: offset}
+	d.links = append(d.links[:0], link{start: offset})
+	d.last = noGranule
+	d.index.reset(offset)
+	d.partial = d.partial[:0]
+	d.continuing = false
+	d.info.Store(nil)
+	d.playhead.Store(0)
+	d.skippedBytes.Store(0)
+	d.skippedPages.Store(0)
+	return nil
+}
+
 func (d *Decoder) decode(ctx context.Context, dst io.Writer) error {
-	var err error
-	var granule uint64
-	var nsegs = new(int)
-	var packetBuf, segTblBuf []byte
+	var p page
+	pl := newPlayer(ctx, d, dst)
+	defer pl.silence()
 
 	for {
-		d.c.WaitIfPaused()
-
 		select {
 		case <-ctx.Done():
 			return nil
+		case req := <-d.seeks:
+			pl.seek(req)
 		default:
-			if test {
-				time.Sleep(500 * time.Millisecond)
-			}
-
-			// Check if we should update the offset
-			d.Time = time.Duration(float64(granule)/SampleRate) * time.Second
-
 			// Read in the data from the src
-			_, granule, err = d.readPage(&packetBuf, &segTblBuf, nsegs)
+			err := d.readPage(&p)
 			if err != nil {
 				return err
 			}
 
-			// Write the data to the destination
-			err = d.writePage(&packetBuf, &segTblBuf, nsegs, dst)
-			if err != nil {
+			// Write the data to the destination, if we seeked
+			// part way through then the rest of the page is dropped
+			err = d.handlePage(&p, pl)
+			if err != nil && !errors.Is(err, errSeeked) {
 				return err
 			}
 		}
 	}
 }
 
-func (d *Decoder) seek(goal time.Duration) (int64, error) {
-	var total, n int
-	var granule uint64
-	var byteOffset int64
-	var minDifference = goal
+// handlePage writes the packets in the page to the dst if it belongs
+// to the opus stream being decoded, then records where the page is
+func (d *Decoder) handlePage(p *page, dst io.Writer) error {
+	if !d.selectStream(p) {
+		return nil
+	}
+	err := d.writePackets(p, dst)
+	if err != nil {
+		return err
+	}
+	if p.Granule == noGranule {
+		return nil
+	}
 
-	var err error
-	var nsegs = new(int)
-	var packetBuf, segTblBuf []byte
+	// The page's granule is exact so the clock is corrected to it
+	l := d.links[d.link]
+	d.granule = p.Granule
+	d.pos = l.base + subGranule(p.Granule, l.preSkip())
+	d.playhead.Store(int64(granuleDuration(d.pos)))
+	d.index.add(indexEntry{
+		start:   p.start,
+		end:     d.offset,
+		prev:    d.prev,
+		pos:     d.pos,
+		granule: p.Granule,
+		link:    d.link,
+	})
+	d.prev = p.start
+	return nil
+}
 
-	// First we seek back to the start of the file
-	o, err := d.src.Seek(0, io.SeekStart)
+// tick advances the clock by the duration of the packet
+func (d *Decoder) tick(packet []byte) {
+	// Invalid packets are left to the page's granule to correct
+	n, err := packetSamples(packet)
 	if err != nil {
-		return o, err
+		return
 	}
+	d.granule += n
+	l := d.links[d.link]
+	d.playhead.Store(int64(granuleDuration(l.base + subGranule(d.granule, l.preSkip()))))
+}
 
+// readPage reads the next valid page from the src. If the page at the current
+// offset is corrupt or truncated the decoder skips forward to the next page
+// boundary, keeping count of the data it discarded
+func (d *Decoder) readPage(p *page) error {
+	start := d.offset
 	for {
-		// Check if we should update the offset
-		current := time.Duration(float64(granule)/SampleRate) * time.Second
-		difference := goal - current
-		if difference < 0 {
-			difference *= -1
+		offset := d.offset
+		err := d.readRawPage(p)
+		if err == nil {
+			if offset > start {
+				d.skip(offset - start)
+			}
+			return nil
 		}
-		if difference < minDifference {
-			minDifference = difference
-			byteOffset = int64(total)
+		if err == io.EOF && offset == start {
+			return io.EOF
+		}
+		if err != errCorruptPage && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
 		}
 
-		// Read the next ogg page
-		n, granule, err = d.readPage(&packetBuf, &segTblBuf, nsegs)
+		// Search for the next page after the start of the corrupt one
+		err = d.resync(offset + 1)
+		if err == io.EOF {
+			d.skip(d.offset - start)
+			return io.EOF
+		}
 		if err != nil {
-			if goal > current {
-				return 0, errors.New("the seek duration specified is invalid")
-			}
-			return byteOffset, err
+			return err
 		}
-		total += n
 	}
 }
 
-func (d *Decoder) readPage(packetBuf, segTblBuf *[]byte, nsegs *int) (int, uint64, error) {
-	var n int
-	var header pageHeader
+// readRawPage reads the page at the current offset in the src, it fails with
+// errCorruptPage if the page is not a valid ogg page
+func (d *Decoder) readRawPage(p *page) error {
+	p.start = d.offset
 	headerBuf := d.buffer[:HeaderSize]
 
 	// Read in the data into the header buffer
 	b, err := io.ReadFull(d.src, headerBuf)
-	n += b
+	d.offset += int64(b)
 	if err != nil {
-		return n, 0, err
+		return err
 	}
 	// Bytes 0-3 of the header should equal "OggS"
-	if !bytes.Equal(headerBuf[:4:4], []byte{'O', 'g', 'g', 'S'}) {
-		return n, 0, fmt.Errorf("invalid oggs header: %q, \"%s\", \"% x\"", headerBuf[:4], headerBuf[:4], headerBuf)
+	if !bytes.Equal(headerBuf[:4:4], capturePattern) {
+		return errCorruptPage
 	}
 	// Header is valid so read in the data into pageHeader struct
-	_, err = header.Read(headerBuf)
+	_, err = p.pageHeader.Read(headerBuf)
 	if err != nil {
-		return n, 0, err
-	}
-	// The segment table size must be valid
-	if header.Nsegs < 1 {
-		return n, 0, errors.New("invalid segment table size")
+		return err
 	}
 
 	// Read in the segment table based on the number of segments we have
-	*nsegs = int(header.Nsegs)
-	*segTblBuf = d.buffer[HeaderSize : HeaderSize+*nsegs]
-	b, err = io.ReadFull(d.src, *segTblBuf)
-	n += b
+	nsegs := int(p.Nsegs)
+	p.segTbl = d.buffer[HeaderSize : HeaderSize+nsegs]
+	b, err = io.ReadFull(d.src, p.segTbl)
+	d.offset += int64(b)
 	if err != nil {
-		return n, 0, err
+		return err
 	}
 	// Calculate the length of the packet data
 	var pageDataLen = 0
-	for _, l := range *segTblBuf {
+	for _, l := range p.segTbl {
 		pageDataLen += int(l)
 	}
 	// Populate the packet buf with the packet data
-	*packetBuf = d.buffer[HeaderSize+*nsegs : HeaderSize+*nsegs+pageDataLen]
-	b, err = io.ReadFull(d.src, *packetBuf)
-	n += b
+	p.data = d.buffer[HeaderSize+nsegs : HeaderSize+nsegs+pageDataLen]
+	b, err = io.ReadFull(d.src, p.data)
+	d.offset += int64(b)
 	if err != nil {
-		return n, 0, err
+		return err
+	}
+
+	// Ensure the page wasn't corrupted
+	if pageChecksum(headerBuf, p.segTbl, p.data) != p.Checksum {
+		return errCorruptPage
 	}
 
-	return n, header.Granule, nil
+	return nil
 }
 
-func (d *Decoder) writePage(packetBuf, segTblBuf *[]byte, nsegs *int, dst io.Writer) error {
-	// Segment index
-	var ixseg int = 0
-	// Start and end of our location in
-	// the packet buffer which we then
-	// write in to the destination buffer
-	var start int64 = 0
-	var end int64 = 0
+// resync positions the src at the next capture pattern found at or after
+// the offset, io.EOF is returned if there are no more pages
+func (d *Decoder) resync(offset int64) error {
+	_, err := d.src.Seek(offset, io.SeekStart)
+	if err != nil {
+		return err
+	}
+	d.offset = offset
 
+	// The buffer is reused for scanning, we keep the last few bytes of each
+	// read so we can find capture patterns split across two reads
+	var carry int
+	pos := offset
 	for {
-		// Get the full segment size
-		for ixseg < *nsegs {
-			segment := (*segTblBuf)[ixseg]
-			end += int64(segment)
+		n, err := io.ReadAtLeast(d.src, d.buffer[carry:], 1)
+		n += carry
+		d.offset = pos + int64(n)
+
+		if i := bytes.Index(d.buffer[:n], capturePattern); i >= 0 {
+			d.offset = pos + int64(i)
+			_, err = d.src.Seek(d.offset, io.SeekStart)
+			return err
+		}
+		if err != nil {
+			return err
+		}
 
-			ixseg++
+		carry = len(capturePattern) - 1
+		if n < carry {
+			carry = n
+		}
+		copy(d.buffer, d.buffer[n-carry:n])
+		pos += int64(n - carry)
+	}
+}
 
-			if segment < 0xFF {
-				break
+// skip records data which was discarded, since we don't know which
+// pages were lost the index can't link the next page to the previous
+func (d *Decoder) skip(n int64) {
+	d.prev = -1
+	d.skippedBytes.Add(n)
+	d.skippedPages.Add(1)
+}
+
+// writePackets writes each packet which finishes on the page to the dst,
+// packets which continue onto the next page are held on to until they're
+// complete
+func (d *Decoder) writePackets(p *page, dst io.Writer) error {
+	// If we don't have the start of a continued packet we have to drop it,
+	// this happens after seeking or skipping a corrupt page
+	continued := p.Type&continuedPacket != 0
+	drop := continued && !d.continuing
+	if !continued || drop {
+		d.partial = d.partial[:0]
+	}
+	d.continuing = false
+
+	var start, end int
+	for i, segment := range p.segTbl {
+		end += int(segment)
+		if segment == MaxSegmentSize {
+			// The packet carries on into the next page
+			if i == len(p.segTbl)-1 && !drop {
+				d.partial = append(d.partial, p.data[start:end]...)
+				d.continuing = true
 			}
+			continue
 		}
-		// Write the segment to the destination
-		_, err := dst.Write((*packetBuf)[start:end])
+
+		packet := p.data[start:end]
+		start = end
+		if drop {
+			drop = false
+			continue
+		}
+		if len(d.partial) > 0 {
+			d.partial = append(d.partial, packet...)
+			packet = d.partial
+		}
+
+		err := d.writePacket(packet, dst)
+		d.partial = d.partial[:0]
 		if err != nil {
-			return fmt.Errorf("failed to write a packet: %w", err)
+			return err
 		}
-		// Check if we are done iterating
-		if ixseg >= *nsegs {
-			return nil
+	}
+	return nil
+}
+
+// writePacket writes an audio packet to the dst, the opus header
+// packets are parsed instead of being written
+func (d *Decoder) writePacket(packet []byte, dst io.Writer) error {
+	switch {
+	case d.headers == expectHead && isOpusHead(packet):
+		head, err := parseOpusHead(packet)
+		if err != nil {
+			return err
 		}
-		// Reset the start position to where we are
-		start = end
+		d.links[d.link].info = &StreamInfo{Head: head}
+		d.setLink(d.link)
+		d.headers = expectTags
+		return nil
+	case d.headers == expectTags && isOpusTags(packet):
+		tags, err := parseOpusTags(packet)
+		if err != nil {
+			return err
+		}
+		d.links[d.link].info = &StreamInfo{Head: d.links[d.link].info.Head, Tags: tags}
+		d.setLink(d.link)
+		d.headers = expectAudio
+		return nil
+	case isOpusHead(packet) || isOpusTags(packet):
+		// We've come across the headers after seeking into them
+		return nil
+	}
+
+	// Streams without headers are played as they are
+	d.headers = expectAudio
+	_, err := dst.Write(packet)
+	if err != nil {
+		return fmt.Errorf("failed to write a packet: %w", err)
 	}
+	d.tick(packet)
+	return nil
 }
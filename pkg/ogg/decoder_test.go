@@ -1,60 +1,420 @@
 package ogg
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"os"
 	"testing"
 	"time"
+
+	"surf/internal/buffer"
+	"surf/internal/sync"
 )
 
+// newTestDecoder returns a decoder whose clock advances
+// by itself so packets are written as fast as possible
+func newTestDecoder() *Decoder {
+	clock := sync.NewFakeClock(time.Time{})
+	clock.SetAutoAdvance(true)
+	return NewDecoderWithClock(clock)
+}
+
 func TestOpus(t *testing.T) {
 	// Read in the data
 	data, err := os.ReadFile("organ.opus") // File from https://www.kozco.com/tech/soundtests.html
 	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The clock only moves when we advance it so we know how far the decoder gets
+	clock := sync.NewFakeClock(time.Time{})
+	d := NewDecoderWithClock(clock)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- d.Decode(ctx, io.Discard, bytes.NewReader(data))
+	}()
+
+	// The decoder should only get slightly ahead of the clock
+	ahead := func(from time.Duration) {
+		t.Helper()
+		clock.BlockUntil(1)
+		if got := d.Time() - from; got < paceAhead || got > paceAhead+100*time.Millisecond {
+			t.Errorf("decoder is %s ahead of %s", got, from)
+		}
+		if got := d.Position() - from; got < 0 || got > 100*time.Millisecond {
+			t.Errorf("position is %s ahead of %s", got, from)
+		}
+	}
+	ahead(0)
+	clock.Advance(time.Second)
+	ahead(time.Second)
+
+	// Test seeking to an arbitrary point and back to the start, the
+	// decoder lands on the page before the goal so it's up to a second out
+	err = d.Seek(8 * time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+	clock.BlockUntil(1)
+	if pos := d.Time() - paceAhead; pos < 7*time.Second || pos > 8*time.Second+100*time.Millisecond {
+		t.Errorf("seeked to %s", pos)
+	}
+	err = d.Seek(0)
+	if err != nil {
+		t.Error(err)
+	}
+	ahead(0)
+
+	// Pausing should stop the decoder at the next packet
+	d.Pause()
+	clock.Advance(20 * time.Millisecond)
+	for d.c.Waiting() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	pos := d.Time()
+	clock.Advance(5 * time.Second)
+	if d.Time() != pos {
+		t.Error("decoder continued whilst paused")
+	}
+
+	// The time spent paused shouldn't let the decoder get further ahead
+	d.Resume()
+	ahead(20 * time.Millisecond)
+
+	// Test seeking past end of file
+	pos = d.Time()
+	err = d.Seek(5 * time.Minute)
+	var rangeErr *SeekRangeError
+	if !errors.As(err, &rangeErr) {
+		t.Errorf("expected a range error but got: %v", err)
+	}
+	if d.Time() != pos {
+		t.Errorf("failed seek moved the decoder from %s to %s", pos, d.Time())
+	}
+
+	// Tell the decoder to stop
+	cancel()
+	if err = <-done; err != nil {
 		t.Error(err)
 	}
+}
 
-	// Create the reader and writer and decoder
-	src := bytes.NewReader(data)
-	var b bytes.Buffer
-	dst := bufio.NewWriter(&b)
-	d := NewDecoder()
+func TestCorruptPage(t *testing.T) {
+	data, err := os.ReadFile("organ.opus")
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// Context for controlling the decoder
-	ctx, cancel := context.WithCancel(context.Background())
+	// Decoding an untouched file should skip nothing
+	d := newTestDecoder()
+	err = d.Decode(context.Background(), io.Discard, bytes.NewReader(data))
+	if err != nil {
+		t.Error(err)
+	}
+	if b, p := d.Skipped(); b != 0 || p != 0 {
+		t.Errorf("skipped %d bytes and %d pages in a valid file", b, p)
+	}
+
+	// Flipping a byte in the middle of the file should only lose that page
+	corrupt := bytes.Clone(data)
+	corrupt[len(corrupt)/2] ^= 0xFF
+	err = d.Decode(context.Background(), io.Discard, bytes.NewReader(corrupt))
+	if err != nil {
+		t.Error(err)
+	}
+	if b, p := d.Skipped(); b == 0 || p != 1 {
+		t.Errorf("expected to skip 1 page but skipped %d bytes and %d pages", b, p)
+	}
+
+	// A truncated file should finish decoding without an error
+	err = d.Decode(context.Background(), io.Discard, bytes.NewReader(data[:len(data)-100]))
+	if err != nil {
+		t.Error(err)
+	}
+	if b, p := d.Skipped(); b == 0 || p != 1 {
+		t.Errorf("expected to skip 1 page but skipped %d bytes and %d pages", b, p)
+	}
+}
+
+func TestSeek(t *testing.T) {
+	data, err := os.ReadFile("organ.opus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := newTestDecoder()
+	readHeaders(t, d, bytes.NewReader(data))
+
+	// Only the headers have been indexed so this has to bisect
+	goal := 8*time.Second + 500*time.Millisecond
+	err = d.seek(goal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.pos > durationGranule(goal) {
+		t.Errorf("seeked past the goal: %s", granuleDuration(d.pos))
+	}
+	var p page
+	err = d.readPage(&p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.handlePage(&p, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	if d.pos <= durationGranule(goal) {
+		t.Errorf("seeked too early, next page ends at %s", granuleDuration(d.pos))
+	}
+
+	// The pages around the goal are now indexed
+	if _, ok := d.index.lookup(durationGranule(goal)); !ok {
+		t.Error("seek did not index the pages it found")
+	}
+
+	// Seeking back to the start should work
+	err = d.seek(0)
+	if err != nil {
+		t.Error(err)
+	}
+	if d.pos != 0 {
+		t.Errorf("seek to start is at %s", granuleDuration(d.pos))
+	}
 
+	// Seeking past the end should tell us how long the track is
+	offset := d.offset
+	err = d.seek(5 * time.Minute)
+	var rangeErr *SeekRangeError
+	if !errors.As(err, &rangeErr) {
+		t.Fatalf("expected a range error but got: %v", err)
+	}
+	if rangeErr.End <= 0 || rangeErr.End > time.Minute {
+		t.Errorf("invalid end of track: %s", rangeErr.End)
+	}
+	if d.offset != offset {
+		t.Error("failed seek moved the decoder")
+	}
+}
+
+// readHeaders resets the decoder to the src and decodes the header pages
+func readHeaders(t *testing.T, d *Decoder, src io.ReadSeeker) {
+	t.Helper()
+
+	err := d.reset(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p page
+	for d.headers != expectAudio {
+		if err = d.readPage(&p); err != nil {
+			t.Fatal(err)
+		}
+		if err = d.handlePage(&p, io.Discard); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// packetRecorder keeps a copy of every packet written to it,
+// apart from the silence written when output stops
+type packetRecorder struct {
+	packets [][]byte
+}
+
+func (r *packetRecorder) Write(p []byte) (int, error) {
+	if bytes.Equal(p, silenceFrame) {
+		return len(p), nil
+	}
+	r.packets = append(r.packets, bytes.Clone(p))
+	return len(p), nil
+}
+
+func TestStreamInfo(t *testing.T) {
+	data, err := os.ReadFile("organ.opus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var r packetRecorder
+	d := newTestDecoder()
+	err = d.Decode(context.Background(), &r, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, ok := d.StreamInfo()
+	if !ok {
+		t.Fatal("no stream info parsed")
+	}
+	if info.Head.Channels != 2 || info.Head.PreSkip != 312 || info.Head.InputSampleRate != 48000 {
+		t.Errorf("invalid identification header: %+v", info.Head)
+	}
+	if info.Tags.Vendor != "Lavf58.29.100" {
+		t.Errorf("invalid vendor: %q", info.Tags.Vendor)
+	}
+	if enc := info.Tags.Get("encoder"); enc != "Lavc58.54.100 libopus" {
+		t.Errorf("invalid encoder comment: %q", enc)
+	}
+
+	// The headers shouldn't be written as audio
+	if len(r.packets) == 0 {
+		t.Fatal("no packets written")
+	}
+	for _, p := range r.packets {
+		if isOpusHead(p) || isOpusTags(p) {
+			t.Fatal("header packet was written")
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	data, err := os.ReadFile("organ.opus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Decode the whole file to know how many packets it has
+	var full packetRecorder
+	d := newTestDecoder()
+	err = d.Decode(context.Background(), &full, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Write the file into the buffer gradually as if it's being downloaded
+	buf := buffer.New()
 	go func() {
-		// Test the seeking to 0
-		time.Sleep(2 * time.Second)
-		err = d.Seek(0)
-		if err != nil {
-			t.Error(err)
+		for i := 0; i < len(data); i += 4096 {
+			time.Sleep(time.Millisecond)
+			end := i + 4096
+			if end > len(data) {
+				end = len(data)
+			}
+			buf.Write(data[i:end])
 		}
+		buf.Close()
+	}()
 
-		// Test the seeking to arbitrary point
-		time.Sleep(1 * time.Second)
-		err = d.Seek(8 * time.Second)
+	// Seeking ahead should wait until the data has arrived
+	d = newTestDecoder()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		for d.run.Load() == nil {
+			time.Sleep(time.Millisecond)
+		}
+		err := d.Seek(8 * time.Second)
 		if err != nil {
 			t.Error(err)
 		}
-
-		// Test seeking past end of file
-		time.Sleep(1 * time.Second)
 		err = d.Seek(5 * time.Minute)
-		if err == nil {
-			t.Error(err)
+		var rangeErr *SeekRangeError
+		if !errors.As(err, &rangeErr) {
+			t.Errorf("expected a range error but got: %v", err)
 		}
-
-		// Tell the decoder to stop
-		cancel()
 	}()
 
-	// Run the decoding
-	test = true
-	err = d.Decode(ctx, dst, src)
+	var r packetRecorder
+	err = d.Decode(context.Background(), &r, buf.NewReader(context.Background()))
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	<-done
+
+	if len(r.packets) == 0 || len(r.packets) >= len(full.packets) {
+		t.Errorf("expected to skip packets by seeking: %d/%d written", len(r.packets), len(full.packets))
+	}
+}
+
+func TestSeekLongStream(t *testing.T) {
+	data, _ := encodeTestStream(t, 1, 3*60*50)
+
+	d := newTestDecoder()
+	readHeaders(t, d, bytes.NewReader(data))
+
+	goal := 61*time.Second + 500*time.Millisecond
+	err := d.seek(goal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos := granuleDuration(d.pos); pos > goal || pos < goal-MaxPageDuration {
+		t.Errorf("seeked to %s instead of %s", pos, goal)
+	}
+
+	// Each page holds a second of audio so the next packet is the 61st second
+	var p page
+	var r packetRecorder
+	if err = d.readPage(&p); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.writePackets(&p, &r); err != nil {
+		t.Fatal(err)
+	}
+	if i := byteOrder.Uint32(r.packets[0][1:5]); i != 61*50 {
+		t.Errorf("first packet after seeking is %d", i)
+	}
+}
+
+// clockRecorder records the decoder's clock whenever a packet is written
+type clockRecorder struct {
+	d     *Decoder
+	times []time.Duration
+}
+
+func (r *clockRecorder) Write(p []byte) (int, error) {
+	if bytes.Equal(p, silenceFrame) {
+		return len(p), nil
+	}
+	r.times = append(r.times, r.d.Time())
+	return len(p), nil
+}
+
+func TestClock(t *testing.T) {
+	data, _ := encodeTestStream(t, 1, 200)
+
+	// The clock should advance by 20ms with every packet, not every page
+	d := newTestDecoder()
+	r := clockRecorder{d: d}
+	err := d.Decode(context.Background(), &r, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	preSkip := granuleDuration(uint64(testInfo.Head.PreSkip))
+	for i, got := range r.times[1:] {
+		if want := time.Duration(i+1)*20*time.Millisecond - preSkip; got != want {
+			t.Fatalf("clock before packet %d is %s instead of %s", i+1, got, want)
+		}
+	}
+	if want := 4*time.Second - preSkip; d.Time() != want {
+		t.Errorf("clock at the end is %s instead of %s", d.Time(), want)
+	}
+
+	// After seeking the clock should continue from where we landed
+	readHeaders(t, d, bytes.NewReader(data))
+	err = d.seek(2*time.Second + 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := d.Time()
+	if start != granuleDuration(d.pos) {
+		t.Errorf("clock is %s after seeking to %s", start, granuleDuration(d.pos))
+	}
+	r.times = nil
+	var p page
+	for i := 0; i < 2; i++ {
+		if err = d.readPage(&p); err != nil {
+			t.Fatal(err)
+		}
+		if err = d.handlePage(&p, &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i, got := range r.times {
+		if want := start + time.Duration(i)*20*time.Millisecond; got != want {
+			t.Fatalf("clock before packet %d after seeking is %s instead of %s", i, got, want)
+		}
 	}
 }
@@ -0,0 +1,196 @@
+package ogg
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// MaxPageDuration is how much audio the encoder puts in each page
+// before starting a new one, the same as what ffmpeg uses
+const MaxPageDuration = time.Second
+
+var ErrEncoderClosed = errors.New("encoder is closed")
+
+// Encoder wraps opus packets into ogg pages, it writes the OpusHead
+// and OpusTags headers before the first packet
+type Encoder struct {
+	// dst is where the pages are written to
+	dst io.Writer
+	// info is written as the header packets
+	info StreamInfo
+	// serial identifies the stream and seq is the
+	// sequence number of the next page
+	serial, seq uint32
+	// granule is the position at the end of the last packet added
+	granule uint64
+	// The packets which make up the page being built, samples is the
+	// duration of those packets and continued is set if the first
+	// packet is carried over from the previous page
+	segTbl    []byte
+	data      []byte
+	samples   uint64
+	continued bool
+	// started is set once the headers are written, closed once
+	// the final page has been written
+	started, closed bool
+}
+
+// NewEncoder returns an encoder which writes a single opus stream to the dst
+func NewEncoder(dst io.Writer, serial uint32, info StreamInfo) *Encoder {
+	if info.Head.Version == 0 {
+		info.Head.Version = 1
+	}
+	return &Encoder{
+		dst:    dst,
+		info:   info,
+		serial: serial,
+	}
+}
+
+// WritePacket adds an opus packet to the stream, the duration is
+// how much audio the packet decodes to
+func (e *Encoder) WritePacket(packet []byte, duration time.Duration) error {
+	if e.closed {
+		return ErrEncoderClosed
+	}
+	if err := e.writeHeaders(); err != nil {
+		return err
+	}
+
+	// Start a new page once the current one holds enough audio
+	if e.samples > 0 && granuleDuration(e.samples) >= MaxPageDuration {
+		if err := e.flush(0); err != nil {
+			return err
+		}
+	}
+
+	if err := e.addPacket(packet); err != nil {
+		return err
+	}
+	e.granule += durationGranule(duration)
+	e.samples += durationGranule(duration)
+	return nil
+}
+
+// Close writes the remaining packets in a final page which
+// marks the end of the stream, it doesn't close the dst
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	if err := e.writeHeaders(); err != nil {
+		return err
+	}
+	e.closed = true
+	return e.flush(endOfStream)
+}
+
+// writeHeaders writes the identification header on its own page
+// followed by the comment header, as required by RFC 7845
+func (e *Encoder) writeHeaders() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	if err := e.addPacket(e.info.Head.marshal()); err != nil {
+		return err
+	}
+	if err := e.flush(beginningOfStream); err != nil {
+		return err
+	}
+	if err := e.addPacket(e.info.Tags.marshal()); err != nil {
+		return err
+	}
+	return e.flush(0)
+}
+
+// addPacket laces the packet into the current page, if the page
+// runs out of segments the packet is continued onto the next page
+func (e *Encoder) addPacket(packet []byte) error {
+	for {
+		free := MaxSegmentSize - len(e.segTbl)
+		full := len(packet) / MaxSegmentSize
+
+		// The packet fits so we can lace it with a final segment
+		// which is less than 255, even if it's empty
+		if full < free {
+			for i := 0; i < full; i++ {
+				e.segTbl = append(e.segTbl, MaxSegmentSize)
+			}
+			e.segTbl = append(e.segTbl, byte(len(packet)%MaxSegmentSize))
+			e.data = append(e.data, packet...)
+			return nil
+		}
+
+		// Otherwise we fill the page and carry on in the next one
+		for i := 0; i < free; i++ {
+			e.segTbl = append(e.segTbl, MaxSegmentSize)
+		}
+		e.data = append(e.data, packet[:free*MaxSegmentSize]...)
+		packet = packet[free*MaxSegmentSize:]
+		if err := e.flushPartial(); err != nil {
+			return err
+		}
+	}
+}
+
+// flush writes the current page, all the packets on it are complete
+func (e *Encoder) flush(flags byte) error {
+	err := e.writePage(flags, e.granule)
+	e.continued = false
+	return err
+}
+
+// flushPartial writes the current page when its last packet carries on
+// into the next page. The granule only counts the packets which finish
+// on the page, if there aren't any then the page has no granule position
+func (e *Encoder) flushPartial() error {
+	granule := e.granule
+	if e.lastFinished() < 0 {
+		granule = noGranule
+	}
+	err := e.writePage(0, granule)
+	e.continued = true
+	return err
+}
+
+// lastFinished returns the index of the last segment which ends a
+// packet in the page being built, it's -1 if there isn't one
+func (e *Encoder) lastFinished() int {
+	for i := len(e.segTbl) - 1; i >= 0; i-- {
+		if e.segTbl[i] < MaxSegmentSize {
+			return i
+		}
+	}
+	return -1
+}
+
+func (e *Encoder) writePage(flags byte, granule uint64) error {
+	if e.continued {
+		flags |= continuedPacket
+	}
+
+	header := make([]byte, HeaderSize, HeaderSize+len(e.segTbl)+len(e.data))
+	copy(header, capturePattern)
+	header[4] = 0 // Version
+	header[5] = flags
+	byteOrder.PutUint64(header[6:14], granule)
+	byteOrder.PutUint32(header[14:18], e.serial)
+	byteOrder.PutUint32(header[18:22], e.seq)
+	header[26] = byte(len(e.segTbl))
+	byteOrder.PutUint32(header[22:26], pageChecksum(header, e.segTbl, e.data))
+
+	page := append(append(header, e.segTbl...), e.data...)
+	if _, err := e.dst.Write(page); err != nil {
+		return fmt.Errorf("failed to write a page: %w", err)
+	}
+
+	e.seq++
+	e.segTbl = e.segTbl[:0]
+	e.data = e.data[:0]
+	e.samples = 0
+	return nil
+}
@@ -0,0 +1,113 @@
+package ogg
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// testInfo is the stream info used for generated fixtures
+var testInfo = StreamInfo{
+	Head: OpusHead{Version: 1, Channels: 2, PreSkip: 312, InputSampleRate: 48000},
+	Tags: OpusTags{Vendor: "surf", Comments: []string{"TITLE=test"}},
+}
+
+// testPacket returns a packet of 20ms stereo CELT audio, the
+// index is written into the packet so they can be told apart
+func testPacket(i, size int) []byte {
+	p := make([]byte, size)
+	p[0] = 0xFC
+	byteOrder.PutUint32(p[1:5], uint32(i))
+	return p
+}
+
+// encodeTestStream returns an ogg file with n 20ms packets
+func encodeTestStream(t *testing.T, serial uint32, n int) ([]byte, [][]byte) {
+	t.Helper()
+
+	var b bytes.Buffer
+	var packets [][]byte
+	e := NewEncoder(&b, serial, testInfo)
+	for i := 0; i < n; i++ {
+		p := testPacket(i, 240)
+		packets = append(packets, p)
+		if err := e.WritePacket(p, 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes(), packets
+}
+
+func TestEncoder(t *testing.T) {
+	data, packets := encodeTestStream(t, 1, 500)
+
+	var r packetRecorder
+	d := newTestDecoder()
+	err := d.Decode(context.Background(), &r, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, p := d.Skipped(); b != 0 || p != 0 {
+		t.Errorf("encoded stream has %d corrupt pages", p)
+	}
+
+	// The headers and packets should survive the round trip
+	info, ok := d.StreamInfo()
+	if !ok || info.Head.PreSkip != testInfo.Head.PreSkip || info.Tags.Get("title") != "test" {
+		t.Errorf("invalid stream info: %+v", info)
+	}
+	if len(r.packets) != len(packets) {
+		t.Fatalf("decoded %d packets but encoded %d", len(r.packets), len(packets))
+	}
+	for i := range packets {
+		if !bytes.Equal(r.packets[i], packets[i]) {
+			t.Fatalf("packet %d is different after decoding", i)
+		}
+	}
+
+	// The granule of the final page should be the length of the audio
+	err = d.reset(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, serial, err := d.lastPage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != 500*960 || serial != 1 {
+		t.Errorf("invalid granule position at end of stream: %d", last)
+	}
+}
+
+func TestEncoderLargePacket(t *testing.T) {
+	// The large packet has to be split over multiple pages
+	var b bytes.Buffer
+	packets := [][]byte{testPacket(0, 240), testPacket(1, 150000), testPacket(2, 240)}
+	e := NewEncoder(&b, 1, testInfo)
+	for _, p := range packets {
+		if err := e.WritePacket(p, 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var r packetRecorder
+	err := newTestDecoder().Decode(context.Background(), &r, bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.packets) != len(packets) {
+		t.Fatalf("decoded %d packets but encoded %d", len(r.packets), len(packets))
+	}
+	for i := range packets {
+		if !bytes.Equal(r.packets[i], packets[i]) {
+			t.Fatalf("packet %d is different after decoding", i)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package ogg
+
+import (
+	"sync"
+	"time"
+)
+
+// eventBuffer is how many events a subscriber can fall behind by
+const eventBuffer = 16
+
+// EventType is the kind of event emitted by the decoder
+type EventType int
+
+const (
+	// EventPosition is emitted every second of playback
+	EventPosition EventType = iota
+	// EventSeek is emitted once a seek has taken effect
+	EventSeek
+	// EventPause is emitted when the decoder stops to pause
+	EventPause
+	// EventResume is emitted when the decoder continues after pausing
+	EventResume
+	// EventEOF is emitted when the end of the src is reached
+	EventEOF
+	// EventError is emitted when decoding fails
+	EventError
+)
+
+func (t EventType) String() string {
+	switch t {
+	case EventPosition:
+		return "position"
+	case EventSeek:
+		return "seek"
+	case EventPause:
+		return "pause"
+	case EventResume:
+		return "resume"
+	case EventEOF:
+		return "eof"
+	case EventError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes something that happened whilst decoding
+type Event struct {
+	Type EventType
+	// Position is the playback position when the event happened
+	Position time.Duration
+	// Err is why decoding failed for EventError
+	Err error
+}
+
+// subscribers holds the channels events are sent to
+type subscribers struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// Subscribe returns a channel which receives the decoder's events
+// and a func to unsubscribe which closes the channel. Events are
+// dropped if the channel is full so they should be read promptly
+func (d *Decoder) Subscribe() (<-chan Event, func()) {
+	s := &d.subs
+	c := make(chan Event, eventBuffer)
+
+	s.mu.Lock()
+	if s.subs == nil {
+		s.subs = make(map[chan Event]struct{})
+	}
+	s.subs[c] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return c, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subs, c)
+			s.mu.Unlock()
+			close(c)
+		})
+	}
+}
+
+// emit sends the event to every subscriber
+func (d *Decoder) emit(t EventType, err error) {
+	e := Event{Type: t, Position: d.Time(), Err: err}
+
+	s := &d.subs
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.subs {
+		select {
+		case c <- e:
+		default:
+		}
+	}
+}
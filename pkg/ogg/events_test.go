@@ -0,0 +1,100 @@
+package ogg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"surf/internal/sync"
+)
+
+// nextEvent returns the next event of the given type, skipping any others
+func nextEvent(t *testing.T, events <-chan Event, typ EventType) Event {
+	t.Helper()
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				t.Fatalf("events closed before %s", typ)
+			}
+			if e.Type == typ {
+				return e
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for %s", typ)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	data, _ := encodeTestStream(t, 1, 200)
+
+	clock := sync.NewFakeClock(time.Time{})
+	d := NewDecoderWithClock(clock)
+	events, unsubscribe := d.Subscribe()
+	defer unsubscribe()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- d.Decode(ctx, io.Discard, bytes.NewReader(data))
+	}()
+
+	// Seeking should tell us where we landed
+	clock.BlockUntil(1)
+	if err := d.Seek(2*time.Second + 500*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	seek := nextEvent(t, events, EventSeek)
+	if seek.Position > 2500*time.Millisecond || seek.Position < 1500*time.Millisecond {
+		t.Errorf("seek event at %s", seek.Position)
+	}
+	if e := nextEvent(t, events, EventPosition); e.Position != seek.Position {
+		t.Errorf("position event at %s after seeking to %s", e.Position, seek.Position)
+	}
+
+	// Pausing only happens once the decoder reaches the next packet
+	d.Pause()
+	clock.Advance(20 * time.Millisecond)
+	paused := nextEvent(t, events, EventPause)
+	d.Resume()
+	if e := nextEvent(t, events, EventResume); e.Position != paused.Position {
+		t.Errorf("resumed at %s but paused at %s", e.Position, paused.Position)
+	}
+
+	// Playing to the end should emit every second and then EOF
+	clock.SetAutoAdvance(true)
+	clock.Advance(time.Second)
+	if e := nextEvent(t, events, EventPosition); e.Position < 3*time.Second || e.Position >= 3*time.Second+20*time.Millisecond {
+		t.Errorf("position event at %s", e.Position)
+	}
+	nextEvent(t, events, EventEOF)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	// Failing to write packets is an error
+	errWrite := errors.New("write failed")
+	err := d.Decode(context.Background(), errWriter{errWrite}, bytes.NewReader(data))
+	if !errors.Is(err, errWrite) {
+		t.Fatalf("expected a write error: %v", err)
+	}
+	if e := nextEvent(t, events, EventError); !errors.Is(e.Err, errWrite) {
+		t.Errorf("invalid error event: %v", e.Err)
+	}
+}
+
+// errWriter fails every write with its error
+type errWriter struct {
+	err error
+}
+
+func (w errWriter) Write([]byte) (int, error) {
+	return 0, w.err
+}
@@ -0,0 +1,103 @@
+package ogg
+
+import "sort"
+
+// noGranule is the granule position of pages on which no packet finishes
+const noGranule = ^uint64(0)
+
+// indexEntry describes where a page of the opus stream is located in the src
+type indexEntry struct {
+	start int64  // Offset where the page starts
+	end   int64  // Offset where the next page starts
+	prev  int64  // Offset of the previous page in the stream, -1 if unknown
+	pos   uint64 // Playback position in samples at the end of the page
+	link  int    // Link of the chained stream the page belongs to
+
+	// granule is the page's granule position in its link
+	granule uint64
+}
+
+// index maps playback positions to byte offsets, it's filled
+// in lazily as pages are read by the decoder
+type index struct {
+	// origin is the offset of the first page in the src
+	origin int64
+	// entries are sorted by their offset
+	entries []indexEntry
+}
+
+func (idx *index) reset(origin int64) {
+	idx.origin = origin
+	idx.entries = idx.entries[:0]
+}
+
+// start returns an entry which represents the start of the src
+func (idx *index) start() indexEntry {
+	return indexEntry{start: idx.origin, end: idx.origin, prev: -1}
+}
+
+func (idx *index) add(e indexEntry) {
+	// Most of the time pages are read sequentially so they can be appended
+	n := len(idx.entries)
+	if n == 0 || idx.entries[n-1].start < e.start {
+		idx.entries = append(idx.entries, e)
+		return
+	}
+
+	i := sort.Search(n, func(i int) bool { return idx.entries[i].start >= e.start })
+	if idx.entries[i].start == e.start {
+		// We might have found out which page comes before it
+		if idx.entries[i].prev == -1 {
+			idx.entries[i].prev = e.prev
+		}
+		return
+	}
+	idx.entries = append(idx.entries, indexEntry{})
+	copy(idx.entries[i+1:], idx.entries[i:])
+	idx.entries[i] = e
+}
+
+// lookup returns the last page which finishes at or before the goal.
+// It fails if the index can't be sure that the page after the one returned
+// goes past the goal, i.e. if the pages around the goal haven't been indexed
+func (idx *index) lookup(goal uint64) (indexEntry, bool) {
+	i := sort.Search(len(idx.entries), func(i int) bool { return idx.entries[i].pos > goal })
+	if i == len(idx.entries) {
+		return indexEntry{}, false
+	}
+
+	// The goal is inside the first page so we start from the beginning,
+	// pages which were read from the start have the origin as their prev
+	if i == 0 {
+		if idx.entries[0].prev != idx.origin {
+			return indexEntry{}, false
+		}
+		return idx.start(), true
+	}
+
+	// The pages must be next to each other for us to be sure
+	// there isn't an unindexed page between them
+	prev := idx.entries[i-1]
+	if idx.entries[i].prev != prev.start {
+		return indexEntry{}, false
+	}
+	return prev, true
+}
+
+// floor returns the last indexed page which finishes at or before the goal,
+// if there isn't one then the start of the src is returned
+func (idx *index) floor(goal uint64) indexEntry {
+	i := sort.Search(len(idx.entries), func(i int) bool { return idx.entries[i].pos > goal })
+	if i == 0 {
+		return idx.start()
+	}
+	return idx.entries[i-1]
+}
+
+// last returns the furthest position which has been indexed
+func (idx *index) last() uint64 {
+	if len(idx.entries) == 0 {
+		return 0
+	}
+	return idx.entries[len(idx.entries)-1].pos
+}
@@ -0,0 +1,233 @@
+package ogg
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"time"
+)
+
+// PageInfo describes a page found by Inspect
+type PageInfo struct {
+	// Offset is where the page starts in the src
+	Offset int64
+	// Version of the ogg format, it should always be 0
+	Version  uint8
+	Serial   uint32
+	Sequence uint32
+	Flags    PageFlags
+	// Granule is the raw granule position, HasGranule is
+	// false if no packet finishes on the page
+	Granule    uint64
+	HasGranule bool
+	Segments   int
+	// Packets are the sizes of the packets on the page, the first may be
+	// continued from the previous page and the last may continue onto
+	// the next page depending on the flags and Continues
+	Packets   []int
+	Continues bool
+	// Time is the playback position at the end of the page, it's only
+	// known for opus streams and if the page has a granule position
+	Time    time.Duration
+	HasTime bool
+	// ValidCRC is false if the page's checksum doesn't match its contents
+	ValidCRC bool
+	// Head and Tags are set if the page holds the opus headers
+	Head *OpusHead
+	Tags *OpusTags
+}
+
+// PageFlags are the header type flags of a page
+type PageFlags byte
+
+func (f PageFlags) Continued() bool { return f&continuedPacket != 0 }
+func (f PageFlags) BOS() bool       { return f&beginningOfStream != 0 }
+func (f PageFlags) EOS() bool       { return f&endOfStream != 0 }
+
+func (f PageFlags) String() string {
+	var flags []string
+	if f.Continued() {
+		flags = append(flags, "cont")
+	}
+	if f.BOS() {
+		flags = append(flags, "bos")
+	}
+	if f.EOS() {
+		flags = append(flags, "eos")
+	}
+	if len(flags) == 0 {
+		return "-"
+	}
+	return strings.Join(flags, ",")
+}
+
+// InspectSummary describes the whole src read by Inspect
+type InspectSummary struct {
+	// Size is the number of bytes read from the src
+	Size  int64
+	Pages int
+	// CorruptPages have an invalid checksum, SkippedBytes are bytes
+	// between pages and Truncated is set if the last page is incomplete
+	CorruptPages int
+	SkippedBytes int64
+	Truncated    bool
+	// Streams are the opus streams found in the src, in the order they start
+	Streams []InspectStream
+	// Duration is the total playback time of the opus streams
+	Duration time.Duration
+}
+
+// Bitrate returns the average bitrate of the src in bits per second
+func (s InspectSummary) Bitrate() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Size*8) / s.Duration.Seconds()
+}
+
+// InspectStream describes an opus stream found by Inspect
+type InspectStream struct {
+	Serial   uint32
+	Info     StreamInfo
+	Duration time.Duration
+}
+
+// Inspect reads every page in the src, valid or not, and calls fn with a
+// description of it. It's meant for diagnosing broken files so unlike the
+// Decoder it doesn't skip corrupt pages and it doesn't seek
+func Inspect(src io.Reader, fn func(PageInfo) error) (InspectSummary, error) {
+	var s InspectSummary
+	r := bufio.NewReaderSize(src, MaxPageSize)
+	streams := make(map[uint32]int)
+	buf := make([]byte, MaxPageSize)
+
+	for {
+		// Anything before the next capture pattern isn't part of a page
+		skipped, err := skipToPage(r)
+		s.Size += skipped
+		s.SkippedBytes += skipped
+		if err == io.EOF {
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+
+		info, n, err := inspectPage(r, buf)
+		info.Offset = s.Size
+		s.Size += n
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			s.Truncated = true
+			return s, nil
+		}
+		if err != nil {
+			return s, err
+		}
+		s.Pages++
+		if !info.ValidCRC {
+			s.CorruptPages++
+		}
+
+		// Keep track of the opus streams so the timestamps can be worked out
+		data := buf[HeaderSize+info.Segments : n]
+		i, ok := streams[info.Serial]
+		switch {
+		case info.Flags.BOS() && isOpusHead(data):
+			head, err := parseOpusHead(data)
+			if err == nil {
+				info.Head = &head
+				streams[info.Serial] = len(s.Streams)
+				s.Streams = append(s.Streams, InspectStream{Serial: info.Serial, Info: StreamInfo{Head: head}})
+			}
+		case ok && isOpusTags(data):
+			tags, err := parseOpusTags(data)
+			if err == nil {
+				info.Tags = &tags
+				s.Streams[i].Info.Tags = tags
+			}
+		}
+		if i, ok := streams[info.Serial]; ok && info.HasGranule {
+			info.Time = granuleDuration(subGranule(info.Granule, uint64(s.Streams[i].Info.Head.PreSkip)))
+			info.HasTime = true
+			if info.Time > s.Streams[i].Duration {
+				s.Duration += info.Time - s.Streams[i].Duration
+				s.Streams[i].Duration = info.Time
+			}
+		}
+
+		if fn != nil {
+			if err := fn(info); err != nil {
+				return s, err
+			}
+		}
+	}
+}
+
+// skipToPage discards bytes until the next capture pattern
+func skipToPage(r *bufio.Reader) (int64, error) {
+	var skipped int64
+	for {
+		b, err := r.Peek(len(capturePattern))
+		if bytes.Equal(b, capturePattern) {
+			return skipped, nil
+		}
+		if err != nil {
+			// Trailing bytes which can't be a page are skipped too
+			n, _ := r.Discard(len(b))
+			return skipped + int64(n), io.EOF
+		}
+		r.Discard(1)
+		skipped++
+	}
+}
+
+// inspectPage reads the page into the buf and describes it,
+// it returns how many bytes of the page were read
+func inspectPage(r *bufio.Reader, buf []byte) (PageInfo, int64, error) {
+	var info PageInfo
+	var ph pageHeader
+
+	header := buf[:HeaderSize]
+	n, err := io.ReadFull(r, header)
+	if err != nil {
+		return info, int64(n), err
+	}
+	ph.Read(header)
+	info.Version = header[4]
+	info.Serial = ph.Serial
+	info.Sequence = ph.Sequence
+	info.Flags = PageFlags(ph.Type)
+	info.Granule = ph.Granule
+	info.HasGranule = ph.Granule != noGranule
+	info.Segments = int(ph.Nsegs)
+
+	segTbl := buf[HeaderSize : HeaderSize+info.Segments]
+	m, err := io.ReadFull(r, segTbl)
+	n += m
+	if err != nil {
+		return info, int64(n), err
+	}
+	var size, dataLen int
+	for _, l := range segTbl {
+		size += int(l)
+		dataLen += int(l)
+		if l < MaxSegmentSize {
+			info.Packets = append(info.Packets, size)
+			size = 0
+		}
+	}
+	if len(segTbl) > 0 && segTbl[len(segTbl)-1] == MaxSegmentSize {
+		info.Packets = append(info.Packets, size)
+		info.Continues = true
+	}
+
+	data := buf[HeaderSize+info.Segments : HeaderSize+info.Segments+dataLen]
+	m, err = io.ReadFull(r, data)
+	n += m
+	if err != nil {
+		return info, int64(n), err
+	}
+	info.ValidCRC = pageChecksum(header, segTbl, data) == ph.Checksum
+	return info, int64(n), nil
+}
@@ -0,0 +1,46 @@
+package ogg
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	data, err := os.ReadFile("organ.opus")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pages []PageInfo
+	s, err := Inspect(bytes.NewReader(data), func(p PageInfo) error {
+		pages = append(pages, p)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size != int64(len(data)) || s.Pages != len(pages) || s.CorruptPages != 0 || s.SkippedBytes != 0 || s.Truncated {
+		t.Errorf("invalid summary: %+v", s)
+	}
+	if len(s.Streams) != 1 || s.Streams[0].Info.Head.PreSkip != 312 || s.Streams[0].Info.Tags.Vendor != "Lavf58.29.100" {
+		t.Errorf("invalid streams: %+v", s.Streams)
+	}
+	if s.Duration != s.Streams[0].Duration || s.Bitrate() <= 0 {
+		t.Errorf("invalid duration %s or bitrate %f", s.Duration, s.Bitrate())
+	}
+	if !pages[0].Flags.BOS() || pages[0].Head == nil || pages[1].Tags == nil || !pages[len(pages)-1].Flags.EOS() {
+		t.Error("headers or flags weren't found")
+	}
+
+	// Broken files should still be read through
+	broken := append([]byte("junk"), data...)
+	broken[len(broken)/2] ^= 0xFF
+	s, err = Inspect(bytes.NewReader(broken[:len(broken)-10]), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.SkippedBytes != 4 || s.CorruptPages != 1 || !s.Truncated {
+		t.Errorf("invalid summary of broken file: %+v", s)
+	}
+}
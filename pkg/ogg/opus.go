@@ -0,0 +1,166 @@
+package ogg
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+)
+
+var (
+	opusHeadMagic = []byte("OpusHead")
+	opusTagsMagic = []byte("OpusTags")
+)
+
+// StreamInfo describes the opus stream being decoded, it's
+// parsed from the identification and comment headers
+type StreamInfo struct {
+	Head OpusHead
+	Tags OpusTags
+}
+
+// OpusHead is the identification header of an opus stream
+type OpusHead struct {
+	Version  uint8
+	Channels uint8
+	// PreSkip is the number of samples to discard from the start of the stream
+	PreSkip uint16
+	// InputSampleRate is the sample rate of the original audio, it's only
+	// informational since opus is always decoded at 48KHz
+	InputSampleRate uint32
+	// OutputGain is the gain to apply when decoding in Q7.8 dB
+	OutputGain    int16
+	MappingFamily uint8
+	// The following fields are only set when MappingFamily isn't 0
+	StreamCount    uint8
+	CoupledCount   uint8
+	ChannelMapping []uint8
+}
+
+// Gain returns the output gain in dB
+func (h OpusHead) Gain() float64 {
+	return float64(h.OutputGain) / 256
+}
+
+// OpusTags is the comment header of an opus stream
+type OpusTags struct {
+	Vendor string
+	// Comments are in the form "KEY=value"
+	Comments []string
+}
+
+// Get returns the value of the first comment with the key, keys are case-insensitive
+func (t OpusTags) Get(key string) string {
+	for _, c := range t.Comments {
+		k, v, ok := strings.Cut(c, "=")
+		if ok && strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func isOpusHead(packet []byte) bool {
+	return bytes.HasPrefix(packet, opusHeadMagic)
+}
+
+func isOpusTags(packet []byte) bool {
+	return bytes.HasPrefix(packet, opusTagsMagic)
+}
+
+func parseOpusHead(packet []byte) (OpusHead, error) {
+	var h OpusHead
+	if !isOpusHead(packet) || len(packet) < 19 {
+		return h, errors.New("invalid opus identification header")
+	}
+
+	h.Version = packet[8]
+	h.Channels = packet[9]
+	h.PreSkip = byteOrder.Uint16(packet[10:12])
+	h.InputSampleRate = byteOrder.Uint32(packet[12:16])
+	h.OutputGain = int16(byteOrder.Uint16(packet[16:18]))
+	h.MappingFamily = packet[18]
+	if h.MappingFamily == 0 {
+		return h, nil
+	}
+
+	if len(packet) < 21+int(h.Channels) {
+		return h, errors.New("invalid opus channel mapping table")
+	}
+	h.StreamCount = packet[19]
+	h.CoupledCount = packet[20]
+	h.ChannelMapping = append([]uint8(nil), packet[21:21+int(h.Channels)]...)
+	return h, nil
+}
+
+func parseOpusTags(packet []byte) (OpusTags, error) {
+	var t OpusTags
+	if !isOpusTags(packet) {
+		return t, errors.New("invalid opus comment header")
+	}
+	errInvalid := errors.New("opus comment header is truncated")
+
+	// Reads a length prefixed string from the packet
+	b := packet[len(opusTagsMagic):]
+	readString := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := byteOrder.Uint32(b)
+		if uint64(len(b)-4) < uint64(n) {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+
+	vendor, ok := readString()
+	if !ok {
+		return t, errInvalid
+	}
+	t.Vendor = vendor
+
+	if len(b) < 4 {
+		return t, errInvalid
+	}
+	count := byteOrder.Uint32(b)
+	b = b[4:]
+	for i := uint32(0); i < count; i++ {
+		c, ok := readString()
+		if !ok {
+			return t, errInvalid
+		}
+		t.Comments = append(t.Comments, c)
+	}
+	return t, nil
+}
+
+// marshal encodes the identification header into a packet
+func (h OpusHead) marshal() []byte {
+	b := make([]byte, 19, 21+len(h.ChannelMapping))
+	copy(b, opusHeadMagic)
+	b[8] = h.Version
+	b[9] = h.Channels
+	byteOrder.PutUint16(b[10:12], h.PreSkip)
+	byteOrder.PutUint32(b[12:16], h.InputSampleRate)
+	byteOrder.PutUint16(b[16:18], uint16(h.OutputGain))
+	b[18] = h.MappingFamily
+	if h.MappingFamily != 0 {
+		b = append(b, h.StreamCount, h.CoupledCount)
+		b = append(b, h.ChannelMapping...)
+	}
+	return b
+}
+
+// marshal encodes the comment header into a packet
+func (t OpusTags) marshal() []byte {
+	b := append([]byte(nil), opusTagsMagic...)
+	b = byteOrder.AppendUint32(b, uint32(len(t.Vendor)))
+	b = append(b, t.Vendor...)
+	b = byteOrder.AppendUint32(b, uint32(len(t.Comments)))
+	for _, c := range t.Comments {
+		b = byteOrder.AppendUint32(b, uint32(len(c)))
+		b = append(b, c...)
+	}
+	return b
+}
@@ -3,6 +3,7 @@ package ogg
 import (
 	"encoding/binary"
 	"io"
+	"time"
 )
 
 const (
@@ -18,9 +19,34 @@ const (
 	SampleRate = 48000
 )
 
+// Header type flags
+const (
+	// continuedPacket is set if the first packet on the
+	// page is continued from the previous page
+	continuedPacket = 0x01
+	// beginningOfStream is set on the first page of a stream
+	beginningOfStream = 0x02
+	// endOfStream is set on the last page of a stream
+	endOfStream = 0x04
+)
+
 type pageHeader struct {
-	Granule uint64 // For opus, this is the sample position
-	Nsegs   byte   // Number of segments in page
+	Type     byte   // Header type flags
+	Granule  uint64 // For opus, this is the sample position
+	Serial   uint32 // Identifies which logical stream the page belongs to
+	Sequence uint32 // Page number within the logical stream
+	Checksum uint32 // CRC32 of the whole page
+	Nsegs    byte   // Number of segments in page
+}
+
+// page is a full ogg page read from the src, the
+// segment table and data are only valid until the
+// next page is read
+type page struct {
+	pageHeader
+	start  int64 // Offset of the page in the src
+	segTbl []byte
+	data   []byte
 }
 
 var byteOrder = binary.LittleEndian
@@ -32,8 +58,37 @@ func (ph *pageHeader) Read(b []byte) (int, error) {
 	}
 
 	// We only care about this.
+	ph.Type = b[5]
 	ph.Granule = byteOrder.Uint64(b[6:14])
+	ph.Serial = byteOrder.Uint32(b[14:18])
+	ph.Sequence = byteOrder.Uint32(b[18:22])
+	ph.Checksum = byteOrder.Uint32(b[22:26])
 	ph.Nsegs = b[26]
 
 	return HeaderSize, nil
 }
+
+// granuleDuration converts a granule position into its timestamp
+func granuleDuration(granule uint64) time.Duration {
+	secs := granule / SampleRate
+	rem := granule % SampleRate
+	return time.Duration(secs)*time.Second + time.Duration(rem)*time.Second/SampleRate
+}
+
+// subGranule subtracts b from a, stopping at zero
+func subGranule(a, b uint64) uint64 {
+	if a < b {
+		return 0
+	}
+	return a - b
+}
+
+// durationGranule converts a timestamp into its granule position
+func durationGranule(d time.Duration) uint64 {
+	if d < 0 {
+		return 0
+	}
+	secs := d / time.Second
+	rem := d % time.Second
+	return uint64(secs)*SampleRate + uint64(rem*SampleRate/time.Second)
+}
@@ -0,0 +1,133 @@
+package ogg
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+// paceAhead is how far ahead of the clock packets are written,
+// it stops the dst from running dry if the decoder is held up
+const paceAhead = 100 * time.Millisecond
+
+// silenceFrames are written whenever output stops, otherwise
+// clients interpolate the last packet which sounds like a glitch
+const silenceFrames = 5
+
+var (
+	// errSeeked is returned when the decoder seeks whilst writing a page
+	errSeeked = errors.New("seeked whilst writing a page")
+	// silenceFrame is an opus packet of 20ms of silence
+	silenceFrame = []byte{0xF8, 0xFF, 0xFE}
+)
+
+// player writes packets to the dst in time with the decoder's clock. It
+// checks whether to pause or seek before each packet, so they take effect
+// at packet boundaries instead of once the page has been written
+type player struct {
+	ctx context.Context
+	d   *Decoder
+	dst io.Writer
+	// origin is when playback would have started if it had never
+	// been paused or seeked, packets are due at origin + position
+	origin time.Time
+	// second is the last second of playback a position event was emitted for
+	second time.Duration
+	// playing is set if packets have been written since the last silence
+	playing bool
+}
+
+func newPlayer(ctx context.Context, d *Decoder, dst io.Writer) *player {
+	return &player{
+		ctx:    ctx,
+		d:      d,
+		dst:    dst,
+		origin: d.clock.Now().Add(-d.Time()),
+		second: -1,
+	}
+}
+
+func (p *player) Write(packet []byte) (int, error) {
+	p.tick()
+	for {
+		err := p.waitIfPaused()
+		if err != nil {
+			return 0, err
+		}
+
+		due := p.origin.Add(p.d.Time() - paceAhead)
+		t := p.d.clock.NewTimer(due.Sub(p.d.clock.Now()))
+		select {
+		case <-p.ctx.Done():
+			t.Stop()
+			return 0, p.ctx.Err()
+		case req := <-p.d.seeks:
+			t.Stop()
+			if p.seek(req) {
+				return 0, errSeeked
+			}
+		case <-t.C():
+			n, err := p.dst.Write(packet)
+			p.playing = true
+			return n, err
+		}
+	}
+}
+
+// waitIfPaused waits whilst the decoder is paused
+func (p *player) waitIfPaused() error {
+	if !p.d.c.Paused() {
+		return nil
+	}
+
+	p.silence()
+	p.d.emit(EventPause, nil)
+	paused, err := p.d.c.WaitIfPaused(p.ctx)
+	if err != nil {
+		return err
+	}
+	p.d.emit(EventResume, nil)
+
+	// Time spent paused shouldn't count towards playback
+	p.origin = p.origin.Add(paused)
+	return nil
+}
+
+// tick emits a position event once every second of playback
+func (p *player) tick() {
+	second := p.d.Time().Truncate(time.Second)
+	if second != p.second {
+		p.second = second
+		p.d.emit(EventPosition, nil)
+	}
+}
+
+// seek carries out the seek request, it returns whether the decoder moved
+func (p *player) seek(req seekRequest) bool {
+	err := p.d.seek(req.goal)
+	req.err <- err
+	if err != nil {
+		return false
+	}
+	p.silence()
+	p.origin = p.d.clock.Now().Add(-p.d.Time())
+	p.second = -1
+	p.d.emit(EventSeek, nil)
+	return true
+}
+
+// silence writes the silence frames if packets were written since the last time
+func (p *player) silence() {
+	if !p.playing {
+		return
+	}
+	p.playing = false
+
+	// Output has already stopped so there's nothing to do if this fails
+	for i := 0; i < silenceFrames; i++ {
+		if _, err := p.dst.Write(silenceFrame); err != nil {
+			return
+		}
+	}
+}
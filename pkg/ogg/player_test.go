@@ -0,0 +1,93 @@
+package ogg
+
+import (
+	"bytes"
+	"context"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"surf/internal/sync"
+)
+
+// silenceRecorder counts the packets and silence frames written to it
+type silenceRecorder struct {
+	mu               gosync.Mutex
+	packets, silence int
+}
+
+func (r *silenceRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if bytes.Equal(p, silenceFrame) {
+		r.silence++
+	} else {
+		r.packets++
+	}
+	return len(p), nil
+}
+
+func (r *silenceRecorder) counts() (int, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.packets, r.silence
+}
+
+func TestSilence(t *testing.T) {
+	data, _ := encodeTestStream(t, 1, 200)
+
+	clock := sync.NewFakeClock(time.Time{})
+	d := NewDecoderWithClock(clock)
+	events, unsubscribe := d.Subscribe()
+	defer unsubscribe()
+
+	var r silenceRecorder
+	done := make(chan error)
+	go func() {
+		done <- d.Decode(context.Background(), &r, bytes.NewReader(data))
+	}()
+	clock.BlockUntil(1)
+	if _, silence := r.counts(); silence != 0 {
+		t.Errorf("wrote %d silence frames whilst playing", silence)
+	}
+
+	// Silence is written before pausing
+	d.Pause()
+	clock.Advance(20 * time.Millisecond)
+	nextEvent(t, events, EventPause)
+	if _, silence := r.counts(); silence != silenceFrames {
+		t.Errorf("wrote %d silence frames when pausing", silence)
+	}
+
+	// Seeking whilst paused resumes, there's nothing to
+	// silence since no packets were written in between
+	err := d.Seek(time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, events, EventSeek)
+	if _, silence := r.counts(); silence != silenceFrames {
+		t.Errorf("wrote %d silence frames when seeking whilst paused", silence)
+	}
+	clock.BlockUntil(1)
+	err = d.Seek(2 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, events, EventSeek)
+	if _, silence := r.counts(); silence != 2*silenceFrames {
+		t.Errorf("wrote %d silence frames when seeking", silence)
+	}
+
+	// And at the end of the stream
+	clock.SetAutoAdvance(true)
+	clock.Advance(time.Second)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, silence := r.counts(); silence != 3*silenceFrames {
+		t.Errorf("wrote %d silence frames at the end", silence)
+	}
+}
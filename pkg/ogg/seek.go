@@ -0,0 +1,278 @@
+package ogg
+
+import (
+	"bytes"
+	"io"
+	"time"
+)
+
+// snapshot is the state of the decoder which is restored if seeking fails
+type snapshot struct {
+	cursor     cursor
+	playhead   int64
+	partial    []byte
+	continuing bool
+}
+
+// seek moves the decoder to the start of the page which contains the goal.
+// If seeking fails the decoder stays where it was
+func (d *Decoder) seek(goal time.Duration) error {
+	// Pages are read into the spare buffer so the page
+	// being written is still intact if we have to go back
+	d.buffer, d.spare = d.spare, d.buffer
+	defer func() { d.buffer, d.spare = d.spare, d.buffer }()
+
+	s := snapshot{
+		cursor:     d.cursor,
+		playhead:   d.playhead.Load(),
+		partial:    bytes.Clone(d.partial),
+		continuing: d.continuing,
+	}
+	e, err := d.findPage(goal)
+	if err == nil {
+		err = d.seekTo(e)
+	}
+	if err != nil {
+		return d.restore(s, err)
+	}
+	return nil
+}
+
+// seekTo moves the decoder to the end of the page, ready to decode the next one
+func (d *Decoder) seekTo(e indexEntry) error {
+	if _, err := d.src.Seek(e.end, io.SeekStart); err != nil {
+		return err
+	}
+	d.cursor = cursor{offset: e.end, pos: e.pos, granule: e.granule, prev: e.start, headers: expectAudio}
+	if e.end == d.index.origin {
+		// We're back at the start so the headers come next
+		d.headers = expectHead
+	}
+	d.setLink(e.link)
+	d.playhead.Store(int64(granuleDuration(e.pos)))
+	d.partial = d.partial[:0]
+	d.continuing = false
+	return nil
+}
+
+// restore moves the decoder back to where it was before a failed seek
+func (d *Decoder) restore(s snapshot, err error) error {
+	if _, serr := d.src.Seek(s.cursor.offset, io.SeekStart); serr != nil {
+		return serr
+	}
+	d.cursor = s.cursor
+	d.setLink(s.cursor.link)
+	d.playhead.Store(s.playhead)
+	d.partial = append(d.partial[:0], s.partial...)
+	d.continuing = s.continuing
+	return err
+}
+
+// findPage returns the last page which finishes at or before the goal,
+// decoding should resume from the end of this page
+func (d *Decoder) findPage(goal time.Duration) (indexEntry, error) {
+	if goal < 0 {
+		return indexEntry{}, &SeekRangeError{Goal: goal, End: granuleDuration(d.index.last())}
+	}
+	target := durationGranule(goal)
+	if e, ok := d.index.lookup(target); ok {
+		return e, nil
+	}
+
+	// Bisecting only works if the granule positions increase throughout the
+	// whole src, so growing and chained srcs have to be scanned through
+	if !d.bisectable() {
+		return d.scan(goal)
+	}
+	last, serial, err := d.lastPage()
+	if err != nil {
+		return indexEntry{}, err
+	}
+	if serial != d.links[0].serial {
+		return d.scan(goal)
+	}
+
+	end := subGranule(last, d.links[0].preSkip())
+	if target > end {
+		return indexEntry{}, &SeekRangeError{Goal: goal, End: granuleDuration(end)}
+	}
+	return d.bisect(target)
+}
+
+// bisectable returns whether the src can be bisected, only complete
+// srcs which have one opus stream in them can be
+func (d *Decoder) bisectable() bool {
+	if g, ok := d.src.(growingReader); ok {
+		if _, complete := g.Buffered(); !complete {
+			return false
+		}
+	}
+	return len(d.links) == 1 && d.links[0].selected && d.links[0].info != nil
+}
+
+// bisect searches the src for the last page which finishes at or before
+// the goal, halving the range of bytes it has to search each step until
+// it's small enough to scan through linearly
+func (d *Decoder) bisect(goal uint64) (indexEntry, error) {
+	size, err := d.src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return indexEntry{}, err
+	}
+
+	best := d.index.start()
+	lo, hi := d.index.origin, size
+	for hi-lo > MaxPageSize {
+		mid := lo + (hi-lo)/2
+		e, err := d.nextPage(mid, hi, -1)
+		if err == io.EOF || (err == nil && e.pos > goal) {
+			hi = mid
+			continue
+		}
+		if err != nil {
+			return indexEntry{}, err
+		}
+		best, lo = e, e.end
+	}
+
+	// The page is close by so we scan until we go past it
+	for {
+		e, err := d.nextPage(best.end, size, best.start)
+		if err == io.EOF || (err == nil && e.pos > goal) {
+			return best, nil
+		}
+		if err != nil {
+			return indexEntry{}, err
+		}
+		best = e
+	}
+}
+
+// scan decodes forward from the closest indexed page before the goal, without
+// writing any packets, until it goes past the goal. Reads block until the src
+// has the data so it works for growing srcs, and it follows chained streams
+func (d *Decoder) scan(goal time.Duration) (indexEntry, error) {
+	target := durationGranule(goal)
+	err := d.seekTo(d.index.floor(target))
+	if err != nil {
+		return indexEntry{}, err
+	}
+
+	var p page
+	for d.pos <= target {
+		err := d.readPage(&p)
+		if err == io.EOF {
+			// The src ended before reaching the goal
+			if d.pos < target {
+				return indexEntry{}, &SeekRangeError{Goal: goal, End: granuleDuration(d.pos)}
+			}
+			break
+		}
+		if err != nil {
+			return indexEntry{}, err
+		}
+		if err := d.handlePage(&p, io.Discard); err != nil {
+			return indexEntry{}, err
+		}
+	}
+	return d.index.floor(target), nil
+}
+
+// lastPage returns the granule position and serial of the last page in the src
+func (d *Decoder) lastPage() (uint64, uint32, error) {
+	if d.last != noGranule {
+		return d.last, d.lastSerial, nil
+	}
+	size, err := d.src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// The last page must begin within the final MaxPageSize bytes of the
+	// src, unless it's corrupt in which case we keep looking further back
+	var last uint64
+	var serial uint32
+	var p page
+	for start := size; start > d.index.origin; {
+		start -= MaxPageSize
+		if start < d.index.origin {
+			start = d.index.origin
+		}
+
+		found := false
+		for pos := start; ; {
+			err := d.nextRawPage(&p, pos, size)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return 0, 0, err
+			}
+			if p.Granule != noGranule {
+				last, serial, found = p.Granule, p.Serial, true
+			}
+			pos = d.offset
+		}
+		if found {
+			break
+		}
+	}
+
+	d.last, d.lastSerial = last, serial
+	return last, serial, nil
+}
+
+// nextPage finds the first page of the opus stream which starts between
+// from and limit, io.EOF is returned if one doesn't exist. Pages without
+// a granule position are skipped. It's only valid for srcs which can be
+// bisected. prev is the offset of the opus page before from, if known
+func (d *Decoder) nextPage(from, limit, prev int64) (indexEntry, error) {
+	var p page
+	for pos := from; ; {
+		err := d.nextRawPage(&p, pos, limit)
+		if err != nil {
+			return indexEntry{}, err
+		}
+		// We can't be sure of the previous page if any data was skipped
+		if p.start != pos {
+			prev = -1
+		}
+		pos = d.offset
+		if p.Serial != d.links[0].serial || p.Granule == noGranule {
+			continue
+		}
+
+		e := indexEntry{
+			start:   p.start,
+			end:     d.offset,
+			prev:    prev,
+			pos:     subGranule(p.Granule, d.links[0].preSkip()),
+			granule: p.Granule,
+		}
+		d.index.add(e)
+		return e, nil
+	}
+}
+
+// nextRawPage reads the first valid page which starts between from and
+// limit, io.EOF is returned if one doesn't exist
+func (d *Decoder) nextRawPage(p *page, from, limit int64) error {
+	for pos := from; ; {
+		if err := d.resync(pos); err != nil {
+			return err
+		}
+		start := d.offset
+		if start >= limit {
+			return io.EOF
+		}
+
+		err := d.readRawPage(p)
+		switch {
+		case err == nil:
+			return nil
+		case err == errCorruptPage || err == io.EOF || err == io.ErrUnexpectedEOF:
+			pos = start + 1
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package ogg
+
+// link is one of the logical streams in a chained ogg file, the links
+// are played one after the other. A link may multiplex several streams
+// together in which case only the first opus stream is decoded
+type link struct {
+	// start is the offset of the first page of the link
+	start int64
+	// base is how many samples were played before the link started
+	base uint64
+	// serial identifies the opus stream which was selected
+	serial   uint32
+	selected bool
+	// info is parsed from the headers of the selected stream
+	info *StreamInfo
+}
+
+// preSkip returns the number of samples at the start of
+// the link which shouldn't be played
+func (l link) preSkip() uint64 {
+	if l.info == nil {
+		return 0
+	}
+	return uint64(l.info.Head.PreSkip)
+}
+
+// selectStream returns whether the page belongs to the opus stream being
+// decoded. A new link is started when a beginning of stream page follows
+// pages which weren't, the first opus stream in the link is then selected
+func (d *Decoder) selectStream(p *page) bool {
+	if p.Type&beginningOfStream == 0 {
+		d.inBOS = false
+		l := d.links[d.link]
+		return !l.selected || p.Serial == l.serial
+	}
+
+	if !d.inBOS {
+		d.startLink(p.start)
+	}
+	d.inBOS = true
+
+	l := &d.links[d.link]
+	if l.selected {
+		return p.Serial == l.serial
+	}
+	if isOpusHead(p.data) {
+		l.serial = p.Serial
+		l.selected = true
+		return true
+	}
+	return false
+}
+
+// startLink moves the decoder onto the link which starts at the offset,
+// the link is created if we haven't come across it before
+func (d *Decoder) startLink(offset int64) {
+	d.headers = expectHead
+	d.granule = 0
+	for i, l := range d.links {
+		if l.start == offset {
+			d.setLink(i)
+			return
+		}
+	}
+
+	d.links = append(d.links, link{start: offset, base: d.pos})
+	d.setLink(len(d.links) - 1)
+}
+
+func (d *Decoder) setLink(i int) {
+	d.link = i
+	d.info.Store(d.links[i].info)
+}
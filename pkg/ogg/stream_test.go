@@ -0,0 +1,168 @@
+package ogg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// splitPages splits an ogg file into its pages
+func splitPages(data []byte) [][]byte {
+	var pages [][]byte
+	for len(data) > 0 {
+		nsegs := int(data[26])
+		n := HeaderSize + nsegs
+		for _, l := range data[HeaderSize : HeaderSize+nsegs] {
+			n += int(l)
+		}
+		pages = append(pages, data[:n])
+		data = data[n:]
+	}
+	return pages
+}
+
+// otherPage returns a page of a stream which isn't opus
+func otherPage(t *testing.T, serial uint32, seq uint32, flags byte) []byte {
+	t.Helper()
+
+	var b bytes.Buffer
+	e := &Encoder{dst: &b, serial: serial, seq: seq}
+	e.segTbl = []byte{16}
+	e.data = bytes.Repeat([]byte{'x'}, 16)
+	if err := e.writePage(flags, 0); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestChainedStream(t *testing.T) {
+	// The second link has different tags so we can tell them apart
+	first, packets := encodeTestStream(t, 1, 100)
+	info := testInfo
+	info.Tags = OpusTags{Vendor: "surf", Comments: []string{"TITLE=second"}}
+	var b bytes.Buffer
+	e := NewEncoder(&b, 2, info)
+	for i := 0; i < 150; i++ {
+		p := testPacket(i, 240)
+		packets = append(packets, p)
+		if err := e.WritePacket(p, 20*time.Millisecond); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	data := append(bytes.Clone(first), b.Bytes()...)
+
+	// Both links should be played one after the other
+	var r packetRecorder
+	d := newTestDecoder()
+	err := d.Decode(context.Background(), &r, bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.packets) != len(packets) {
+		t.Fatalf("decoded %d packets but encoded %d", len(r.packets), len(packets))
+	}
+	for i := range packets {
+		if !bytes.Equal(r.packets[i], packets[i]) {
+			t.Fatalf("packet %d is different after decoding", i)
+		}
+	}
+	if info, _ := d.StreamInfo(); info.Tags.Get("title") != "second" {
+		t.Errorf("stream info is from the wrong link: %+v", info)
+	}
+
+	// Seeking into the second link should land on its second page
+	readHeaders(t, d, bytes.NewReader(data))
+	err = d.seek(3 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := d.StreamInfo(); info.Tags.Get("title") != "second" {
+		t.Errorf("seeked into the wrong link: %+v", info)
+	}
+	var p page
+	r.packets = nil
+	if err = d.readPage(&p); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.handlePage(&p, &r); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.packets) == 0 || byteOrder.Uint32(r.packets[0][1:5]) != 50 {
+		t.Error("seeked to the wrong page of the second link")
+	}
+
+	// Seeking back should move to the first link
+	err = d.seek(500 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, _ := d.StreamInfo(); info.Tags.Get("title") != "test" {
+		t.Errorf("seeked into the wrong link: %+v", info)
+	}
+
+	// The end of the track is the end of the last link
+	err = d.seek(time.Minute)
+	var rangeErr *SeekRangeError
+	if !errors.As(err, &rangeErr) {
+		t.Fatalf("expected a range error but got: %v", err)
+	}
+	if rangeErr.End < 4900*time.Millisecond || rangeErr.End > 5*time.Second {
+		t.Errorf("invalid end of track: %s", rangeErr.End)
+	}
+}
+
+func TestMultiplexedStream(t *testing.T) {
+	data, packets := encodeTestStream(t, 1, 200)
+	opus := splitPages(data)
+
+	// The other stream starts first so the decoder has to look for the
+	// opus stream, then their pages are interleaved
+	var b bytes.Buffer
+	b.Write(otherPage(t, 9, 0, beginningOfStream))
+	b.Write(opus[0])
+	for i, p := range opus[1:] {
+		b.Write(otherPage(t, 9, uint32(i+1), 0))
+		b.Write(p)
+	}
+	b.Write(otherPage(t, 9, uint32(len(opus)), endOfStream))
+
+	var r packetRecorder
+	d := newTestDecoder()
+	err := d.Decode(context.Background(), &r, bytes.NewReader(b.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.packets) != len(packets) {
+		t.Fatalf("decoded %d packets but encoded %d", len(r.packets), len(packets))
+	}
+	for i := range packets {
+		if !bytes.Equal(r.packets[i], packets[i]) {
+			t.Fatalf("packet %d is different after decoding", i)
+		}
+	}
+
+	// Seeking should skip over the other stream's pages
+	readHeaders(t, d, bytes.NewReader(b.Bytes()))
+	err = d.seek(2*time.Second + 500*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p page
+	r.packets = nil
+	for len(r.packets) == 0 {
+		if err = d.readPage(&p); err != nil {
+			t.Fatal(err)
+		}
+		if err = d.handlePage(&p, &r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if i := byteOrder.Uint32(r.packets[0][1:5]); i != 2*50 {
+		t.Errorf("first packet after seeking is %d", i)
+	}
+}
@@ -0,0 +1,50 @@
+package ogg
+
+import "errors"
+
+// errInvalidPacket is returned when an opus packet has an invalid TOC
+var errInvalidPacket = errors.New("invalid opus packet")
+
+// frameSamples is the number of samples in a frame for each
+// configuration of the TOC byte, in groups of silk, hybrid and celt
+var frameSamples = [32]uint64{
+	480, 960, 1920, 2880, // SILK NB
+	480, 960, 1920, 2880, // SILK MB
+	480, 960, 1920, 2880, // SILK WB
+	480, 960, // Hybrid SWB
+	480, 960, // Hybrid FB
+	120, 240, 480, 960, // CELT NB
+	120, 240, 480, 960, // CELT WB
+	120, 240, 480, 960, // CELT SWB
+	120, 240, 480, 960, // CELT FB
+}
+
+// packetSamples returns the number of 48kHz samples in the opus
+// packet, it's worked out from the packet's TOC byte (RFC 6716 3.1)
+func packetSamples(packet []byte) (uint64, error) {
+	if len(packet) < 1 {
+		return 0, errInvalidPacket
+	}
+	toc := packet[0]
+
+	var frames uint64
+	switch toc & 0x03 {
+	case 0:
+		frames = 1
+	case 1, 2:
+		frames = 2
+	case 3:
+		// The frame count is in the byte after the TOC
+		if len(packet) < 2 {
+			return 0, errInvalidPacket
+		}
+		frames = uint64(packet[1] & 0x3F)
+	}
+
+	// Packets can't be longer than 120ms
+	samples := frames * frameSamples[toc>>3]
+	if frames == 0 || samples > 5760 {
+		return 0, errInvalidPacket
+	}
+	return samples, nil
+}
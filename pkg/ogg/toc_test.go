@@ -0,0 +1,36 @@
+package ogg
+
+import "testing"
+
+func TestPacketSamples(t *testing.T) {
+	tests := []struct {
+		packet  []byte
+		samples uint64
+		err     bool
+	}{
+		{[]byte{0xFC}, 960, false},             // CELT FB 20ms, 1 frame
+		{[]byte{0xE0}, 120, false},             // CELT FB 2.5ms, 1 frame
+		{[]byte{0xFD}, 1920, false},            // CELT FB 20ms, 2 frames
+		{[]byte{0xFE}, 1920, false},            // CELT FB 20ms, 2 frames of different sizes
+		{[]byte{0xFF, 0x03}, 2880, false},      // CELT FB 20ms, 3 frames
+		{[]byte{0x18}, 2880, false},            // SILK NB 60ms
+		{[]byte{0x60}, 480, false},             // Hybrid SWB 10ms
+		{[]byte{0x1B, 0x02}, 5760, false},      // SILK NB 60ms, 2 frames
+		{[]byte{0x1B, 0x03}, 0, true},          // Longer than 120ms
+		{[]byte{0xFF, 0x00}, 0, true},          // No frames
+		{[]byte{0xFF}, 0, true},                // Missing the frame count
+		{[]byte{}, 0, true},                    // Missing the TOC
+		{testPacket(0, 240), 960, false},       // Packets used by the tests
+		{[]byte{0xF8, 0xFF, 0xFE}, 960, false}, // Silence frame
+	}
+
+	for _, tc := range tests {
+		samples, err := packetSamples(tc.packet)
+		if (err != nil) != tc.err {
+			t.Errorf("%x: unexpected error: %v", tc.packet, err)
+		}
+		if samples != tc.samples {
+			t.Errorf("%x: expected %d samples but got %d", tc.packet, tc.samples, samples)
+		}
+	}
+}
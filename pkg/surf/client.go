@@ -1,21 +1,31 @@
 package surf
 
 import (
+	"sync"
+
+	"github.com/diamondburned/arikawa/v3/api"
 	"github.com/diamondburned/arikawa/v3/discord"
 	"github.com/diamondburned/arikawa/v3/gateway"
 	"github.com/diamondburned/arikawa/v3/state"
 	"github.com/rs/zerolog/log"
 
 	"surf/pkg/voice"
+	ytdlp "surf/pkg/yt-dlp"
 )
 
 type client struct {
 	self    *discord.Application
 	state   *state.State
 	manager *voice.Manager
+	// matchAdmins are the users who can override matches
+	matchAdmins map[string]bool
+
+	// searches are waiting for the user to pick a result
+	mu       sync.Mutex
+	searches map[discord.ComponentID]*pendingSearch
 }
 
-func newClient(token, spotifyID, spotifySecret string) (*client, error) {
+func newClient(token string, cfg ytdlp.ClientConfig) (*client, error) {
 	// Setup the state
 	id := gateway.DefaultIdentifier("Bot " + token)
 	id.Presence = &gateway.UpdatePresenceCommand{
@@ -28,7 +38,12 @@ func newClient(token, spotifyID, spotifySecret string) (*client, error) {
 
 	s := state.NewWithIdentifier(id)
 	c := &client{
-		state: s,
+		state:       s,
+		matchAdmins: make(map[string]bool),
+		searches:    make(map[discord.ComponentID]*pendingSearch),
+	}
+	for _, id := range cfg.MatchAdmins {
+		c.matchAdmins[id] = true
 	}
 
 	// Add handlers for events
@@ -42,7 +57,7 @@ func newClient(token, spotifyID, spotifySecret string) (*client, error) {
 	c.self = app
 
 	// Create the voice manager
-	m, err := voice.NewManager(s, spotifyID, spotifySecret)
+	m, err := voice.NewManager(s, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -55,7 +70,7 @@ func (c *client) deleteOldCommands(existingCommands []discord.Command) {
 	for _, oldCmd := range existingCommands {
 		found := false
 		for _, newCmd := range commands {
-			if oldCmd.Name == newCmd.Name && len(oldCmd.Options) == len(newCmd.Options) {
+			if sameCommand(oldCmd, newCmd) {
 				found = true
 			}
 		}
@@ -74,7 +89,7 @@ func (c *client) createNewCommands(existingCommands []discord.Command) {
 	for _, newCmd := range commands {
 		found := false
 		for _, command := range existingCommands {
-			if command.Name == newCmd.Name && len(command.Options) == len(newCmd.Options) {
+			if sameCommand(command, newCmd) {
 				found = true
 			}
 		}
@@ -88,3 +103,16 @@ func (c *client) createNewCommands(existingCommands []discord.Command) {
 		}
 	}
 }
+
+// sameCommand returns whether the registered command is up to date, the
+// permissions are compared so commands which no longer need them are
+// registered again
+func sameCommand(cmd discord.Command, data api.CreateCommandData) bool {
+	if cmd.Name != data.Name || len(cmd.Options) != len(data.Options) {
+		return false
+	}
+	if cmd.DefaultMemberPermissions == nil || data.DefaultMemberPermissions == nil {
+		return cmd.DefaultMemberPermissions == data.DefaultMemberPermissions
+	}
+	return *cmd.DefaultMemberPermissions == *data.DefaultMemberPermissions
+}
@@ -1,9 +1,11 @@
 package surf
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"reflect"
+	"strings"
 
 	"github.com/diamondburned/arikawa/v3/api"
 	"github.com/diamondburned/arikawa/v3/discord"
@@ -15,6 +17,7 @@ import (
 	"golang.org/x/text/language"
 
 	"surf/internal/pretty"
+	"surf/pkg/ogg"
 	"surf/pkg/voice"
 )
 
@@ -35,7 +38,7 @@ var commands = []api.CreateCommandData{
 		Options: []discord.CommandOption{
 			&discord.StringOption{
 				OptionName:  "track",
-				Description: "Search term or URL link to track",
+				Description: "Search term, URL link to track or library: search",
 				Required:    true,
 			},
 		},
@@ -46,7 +49,34 @@ var commands = []api.CreateCommandData{
 		Options: []discord.CommandOption{
 			&discord.StringOption{
 				OptionName:  "track",
-				Description: "Search term or URL link to track",
+				Description: "Search term, URL link to track or library: search",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "search",
+		Description: "Search for a track and pick which result to play",
+		Options: []discord.CommandOption{
+			&discord.StringOption{
+				OptionName:  "query",
+				Description: "Search term",
+				Required:    true,
+			},
+		},
+	},
+	{
+		Name:        "match",
+		Description: "Choose the YouTube video a Spotify track plays",
+		Options: []discord.CommandOption{
+			&discord.StringOption{
+				OptionName:  "spotify",
+				Description: "Link to the Spotify track",
+				Required:    true,
+			},
+			&discord.StringOption{
+				OptionName:  "youtube",
+				Description: "Link to the YouTube video it should play",
 				Required:    true,
 			},
 		},
@@ -156,7 +186,15 @@ func init() {
 
 func interactionCreateEvent(c *client) interface{} {
 	return func(e *gateway.InteractionCreateEvent) {
-		// We only want to accept command interactions i.e. slash-commands
+		// Picking a search result is the only component interaction
+		if si, ok := e.Data.(*discord.StringSelectInteraction); ok {
+			if strings.HasPrefix(string(si.CustomID), searchPrefix) {
+				c.searchSelected(e, si)
+			}
+			return
+		}
+
+		// Otherwise we only want to accept command interactions i.e. slash-commands
 		ci, ok := e.Data.(*discord.CommandInteraction)
 		if !ok {
 			return
@@ -237,6 +275,25 @@ func (c *client) Playnext(ctx voice.SessionContext) {
 	}
 }
 
+func (c *client) Match(ctx voice.SessionContext) {
+	// Matches are used by every server so managing
+	// this one isn't enough to be able to change them
+	if !c.matchAdmins[ctx.User.ID.String()] {
+		log.Error().Str("user", ctx.User.Username).Str("id", ctx.User.ID.String()).Msg("user cannot override matches")
+		c.textResp(ctx, "Only the bot's admins can change matches", true, false)
+		return
+	}
+
+	c.textResp(ctx, "N/A", false, true)
+	t, err := c.manager.OverrideMatch(ctx.FirstArg(), ctx.SecondArg())
+	if err != nil {
+		log.Error().Err(err).Str("spotify", ctx.FirstArg()).Str("youtube", ctx.SecondArg()).Msg("failed to override match")
+		c.editResp(ctx, fmt.Sprintf("Failed to match: %s", err))
+	} else {
+		c.editResp(ctx, fmt.Sprintf("Matched to %s", t.Pretty()))
+	}
+}
+
 func (c *client) Skip(ctx voice.SessionContext) {
 	err := c.manager.Skip(ctx)
 	if err != nil {
@@ -270,7 +327,14 @@ func (c *client) Resume(ctx voice.SessionContext) {
 func (c *client) Seek(ctx voice.SessionContext) {
 	c.textResp(ctx, "N/A", false, true)
 	t, err := c.manager.Seek(ctx)
-	if err != nil {
+	var rangeErr *ogg.SeekRangeError
+	if errors.As(err, &rangeErr) {
+		log.Error().Err(err).Msg("seek outside of track")
+		c.editResp(ctx, fmt.Sprintf("Can only seek between `%s` and `%s`",
+			pretty.Duration(0), pretty.Duration(rangeErr.End)))
+	} else if errors.Is(err, voice.ErrLiveSeek) {
+		c.editResp(ctx, "Can't seek live streams")
+	} else if err != nil {
 		log.Error().Err(err).Msg("failed to seek track")
 		c.editResp(ctx, "Failed...")
 	} else {
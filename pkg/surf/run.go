@@ -7,11 +7,13 @@ import (
 	"syscall"
 
 	"github.com/rs/zerolog/log"
+
+	ytdlp "surf/pkg/yt-dlp"
 )
 
-func Run(token, spotifyID, spotifySecret string) error {
+func Run(token string, cfg ytdlp.ClientConfig) error {
 	// Create the client
-	c, err := newClient(token, spotifyID, spotifySecret)
+	c, err := newClient(token, cfg)
 	if err != nil {
 		return err
 	}
@@ -38,6 +40,9 @@ func Run(token, spotifyID, spotifySecret string) error {
 	<-ctx.Done() // block until Ctrl+C
 	log.Info().Msg("closing bot...")
 
+	if err := c.manager.Close(); err != nil {
+		log.Error().Err(err).Msg("failed to save matches")
+	}
 	if err := c.state.Close(); err != nil {
 		return err
 	}
@@ -0,0 +1,179 @@
+package surf
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/diamondburned/arikawa/v3/api"
+	"github.com/diamondburned/arikawa/v3/discord"
+	"github.com/diamondburned/arikawa/v3/gateway"
+	"github.com/diamondburned/arikawa/v3/utils/json/option"
+	"github.com/rs/zerolog/log"
+
+	"surf/internal/pretty"
+	"surf/pkg/voice"
+	ytdlp "surf/pkg/yt-dlp"
+)
+
+const (
+	// searchResults is how many results /search shows
+	searchResults = 5
+	// searchTimeout is how long the user has to pick a result
+	searchTimeout = time.Minute
+	// searchPrefix starts the custom id of the search select menus
+	searchPrefix = "search:"
+	// selectLimit is the max length of a select option's text
+	selectLimit = 100
+)
+
+// pendingSearch is a search whose results are waiting to be picked
+type pendingSearch struct {
+	ctx    voice.SessionContext
+	tracks []*ytdlp.Track
+	timer  *time.Timer
+}
+
+func (c *client) Search(ctx voice.SessionContext) {
+	c.textResp(ctx, "N/A", false, true)
+	tracks, err := c.manager.Search(ctx.FirstArg(), searchResults)
+	if err != nil {
+		log.Error().Err(err).Str("query", ctx.FirstArg()).Msg("failed to search")
+		c.editResp(ctx, "No tracks found")
+		return
+	}
+
+	id := discord.ComponentID(searchPrefix + ctx.Event.ID.String())
+	menu := &discord.StringSelectComponent{
+		CustomID:    id,
+		Placeholder: "Pick a track to queue",
+		Options:     make([]discord.SelectOption, len(tracks)),
+	}
+	for i, t := range tracks {
+		menu.Options[i] = discord.SelectOption{
+			Label:       truncate(fmt.Sprintf("%d. %s", i+1, t.VideoTitle), selectLimit),
+			Value:       strconv.Itoa(i),
+			Description: truncate(fmt.Sprintf("%s - %s", t.Uploader, pretty.Duration(t.Duration)), selectLimit),
+		}
+	}
+
+	// The menu is removed if nothing is picked in time
+	c.addSearch(id, &pendingSearch{
+		ctx:    ctx,
+		tracks: tracks,
+		timer: time.AfterFunc(searchTimeout, func() {
+			if c.takeSearch(id) != nil {
+				c.editComponentsResp(ctx, "Search expired", discord.ContainerComponents{})
+			}
+		}),
+	})
+	text := fmt.Sprintf("Results for `%s`:", ctx.FirstArg())
+	c.editComponentsResp(ctx, text, discord.Components(menu))
+}
+
+// searchSelected queues the track picked from a search's select menu
+func (c *client) searchSelected(e *gateway.InteractionCreateEvent, si *discord.StringSelectInteraction) {
+	id := si.CustomID
+	ps := c.peekSearch(id)
+	if ps == nil {
+		c.textResp(voice.SessionContext{Event: e}, "This search has expired", true, false)
+		return
+	}
+	if ps.ctx.User.ID != e.SenderID() {
+		c.textResp(voice.SessionContext{Event: e}, "Only the user who searched can pick a track", true, false)
+		return
+	}
+
+	ctx, err := voice.CreateContext(c.state, e, nil)
+	if err != nil {
+		log.Error().Err(err).Str("user", e.Sender().Username).Msg("user is not in voice channel")
+		c.textResp(voice.SessionContext{Event: e}, "You must be in a voice channel", true, false)
+		return
+	}
+	if !c.manager.SameVoiceChannel(ctx) {
+		log.Error().Str("user", e.Sender().Username).Msg("user is not in the same voice channel")
+		c.textResp(voice.SessionContext{Event: e}, "You must be in the same voice channel", true, false)
+		return
+	}
+
+	// The search may have expired or been picked whilst we checked
+	ps = c.takeSearch(id)
+	if ps == nil {
+		c.textResp(ctx, "This search has expired", true, false)
+		return
+	}
+	i := -1
+	if len(si.Values) > 0 {
+		i, _ = strconv.Atoi(si.Values[0])
+	}
+	if i < 0 || i >= len(ps.tracks) {
+		log.Error().Strs("values", si.Values).Msg("invalid search result picked")
+		c.textResp(ctx, "Invalid track", true, false)
+		return
+	}
+	t := ps.tracks[i]
+
+	log.Info().Str("user", ctx.User.Username).Str("command", "search").Str("track", t.URL).
+		Str("guild", ctx.Guild).Str("channel", ctx.Voice).Msg("interaction")
+
+	// Queueing might have to join the voice channel so we defer the reply
+	err = c.state.RespondInteraction(e.ID, e.Token, api.InteractionResponse{Type: api.DeferredMessageUpdate})
+	if err != nil {
+		log.Error().Err(err).Interface("id", e.ID).Msg("failed to defer search response")
+	}
+	resp, err := c.manager.Enqueue(ctx, t)
+	if err != nil {
+		log.Error().Err(err).Str("track", t.URL).Msg("failed to queue search result")
+		if resp == "" {
+			resp = "Failed..."
+		}
+	}
+	c.editComponentsResp(ctx, resp, discord.ContainerComponents{})
+}
+
+func (c *client) addSearch(id discord.ComponentID, ps *pendingSearch) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.searches[id] = ps
+}
+
+func (c *client) peekSearch(id discord.ComponentID) *pendingSearch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.searches[id]
+}
+
+// takeSearch removes the search so its result can only be picked once
+func (c *client) takeSearch(id discord.ComponentID) *pendingSearch {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ps, ok := c.searches[id]
+	if !ok {
+		return nil
+	}
+	ps.timer.Stop()
+	delete(c.searches, id)
+	return ps
+}
+
+func (c *client) editComponentsResp(ctx voice.SessionContext, text string, components discord.ContainerComponents) {
+	data := api.EditInteractionResponseData{
+		Content:    option.NewNullableString(text),
+		Components: &components,
+	}
+
+	if _, err := c.state.EditInteractionResponse(c.self.ID, ctx.Event.Token, data); err != nil {
+		log.Error().Err(err).Interface("id", ctx.Event.ID).Str("resp", text).Msg("failed to send components response")
+	}
+}
+
+// truncate shortens s to at most n characters
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return strings.TrimSpace(string(r[:n-1])) + "…"
+}
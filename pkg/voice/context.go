@@ -45,16 +45,20 @@ func CreateContext(s *state.State, e *gateway.InteractionCreateEvent, ci *discor
 		return SessionContext{}, err
 	}
 
-	return SessionContext{
-		GID:     e.GuildID,
-		Guild:   g.Name,
-		VID:     vs.ChannelID,
-		Voice:   ch.Name,
-		Text:    e.ChannelID,
-		User:    e.Sender(),
-		Event:   e,
-		options: ci.Options,
-	}, nil
+	ctx := SessionContext{
+		GID:   e.GuildID,
+		Guild: g.Name,
+		VID:   vs.ChannelID,
+		Voice: ch.Name,
+		Text:  e.ChannelID,
+		User:  e.Sender(),
+		Event: e,
+	}
+	// Component interactions, e.g. picking a search result, have no options
+	if ci != nil {
+		ctx.options = ci.Options
+	}
+	return ctx, nil
 }
 
 func (ctx *SessionContext) HasFirstArg() bool {
@@ -1,6 +1,7 @@
 package voice
 
 import (
+	"context"
 	"errors"
 	"strconv"
 	"sync"
@@ -23,12 +24,12 @@ type Manager struct {
 	voice map[discord.GuildID]*session
 }
 
-func NewManager(s *state.State, spotifyID, spotifySecrets string) (*Manager, error) {
+func NewManager(s *state.State, cfg ytdlp.ClientConfig) (*Manager, error) {
 	voice.AddIntents(s)
 
 	m := &Manager{
 		state: s,
-		yt:    ytdlp.NewClient(spotifyID, spotifySecrets),
+		yt:    ytdlp.NewClient(cfg),
 		voice: make(map[discord.GuildID]*session),
 	}
 
@@ -133,6 +134,38 @@ func (m *Manager) PlayNext(ctx SessionContext) (string, error) {
 	return m.play(ctx, true)
 }
 
+// Close saves what the client hasn't saved yet, e.g. the matches
+func (m *Manager) Close() error {
+	return m.yt.Close()
+}
+
+// Search returns the top n results for the query without queueing them
+func (m *Manager) Search(query string, n int) ([]*ytdlp.Track, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return m.yt.Search(ctx, query, n)
+}
+
+// OverrideMatch makes the spotify track always play the youtube video
+func (m *Manager) OverrideMatch(link, video string) (*ytdlp.Track, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	return m.yt.OverrideMatch(ctx, link, video)
+}
+
+// Enqueue queues a track the user picked from a search
+func (m *Manager) Enqueue(ctx SessionContext, t *ytdlp.Track) (string, error) {
+	m.mu.Lock()
+	s, err := m.joinVoice(ctx, false)
+	if err != nil {
+		m.mu.Unlock()
+		return "", err
+	}
+	m.mu.Unlock()
+
+	return s.Enqueue(ctx, []*ytdlp.Track{t}, false)
+}
+
 func (m *Manager) Skip(ctx SessionContext) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
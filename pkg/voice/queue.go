@@ -2,6 +2,7 @@ package voice
 
 import (
 	"container/list"
+	"context"
 	"errors"
 	"fmt"
 	"math/rand"
@@ -15,10 +16,13 @@ var ErrEmptyQueue = errors.New("queue is empty")
 type queue struct {
 	l  *list.List
 	yt *ytdlp.Client
+	// lookups returns the ctx which the placeholders
+	// are searched for with once they're downloaded
+	lookups func() context.Context
 }
 
-func newQueue(yt *ytdlp.Client) *queue {
-	return &queue{l: list.New(), yt: yt}
+func newQueue(yt *ytdlp.Client, lookups func() context.Context) *queue {
+	return &queue{l: list.New(), yt: yt, lookups: lookups}
 }
 
 func (q *queue) Init() {
@@ -62,6 +66,19 @@ func (q *queue) PushBack(tracks ...*ytdlp.Track) {
 	}
 }
 
+// PushAfter queues the track after mark so tracks can be queued next in
+// order, it's queued at the front if mark is nil or no longer queued
+func (q *queue) PushAfter(mark *list.Element, t *ytdlp.Track) *list.Element {
+	defer q.bufferAppropriateDls()
+
+	if mark != nil {
+		if e := q.l.InsertAfter(t, mark); e != nil {
+			return e
+		}
+	}
+	return q.l.PushFront(t)
+}
+
 func (q *queue) Remove(i, j int) ([]*ytdlp.Track, error) {
 	if i < 0 || i >= q.Len() {
 		return nil, errors.New("element does not exist")
@@ -164,7 +181,7 @@ func (q *queue) bufferAppropriateDls() {
 			return
 		}
 		t := e.Value.(*ytdlp.Track)
-		t.Download(q.yt)
+		t.Download(q.lookups(), q.yt)
 
 		e = e.Next()
 		count++
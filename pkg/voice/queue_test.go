@@ -1,6 +1,7 @@
 package voice
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -12,7 +13,7 @@ func testAudioTrack(title string) *ytdlp.Track {
 }
 
 func TestMove(t *testing.T) {
-	q := newQueue(ytdlp.NewClient("", ""))
+	q := newQueue(ytdlp.NewClient(ytdlp.ClientConfig{}), context.Background)
 	q.l.PushBack(testAudioTrack("fox"))
 	q.l.PushBack(testAudioTrack("yak"))
 	q.l.PushBack(testAudioTrack("emu"))
@@ -60,7 +61,7 @@ func TestMove(t *testing.T) {
 }
 
 func TestShuffle(t *testing.T) {
-	q := newQueue(ytdlp.NewClient("", ""))
+	q := newQueue(ytdlp.NewClient(ytdlp.ClientConfig{}), context.Background)
 	q.l.PushBack(testAudioTrack("fox"))
 	q.l.PushBack(testAudioTrack("yak"))
 	q.l.PushBack(testAudioTrack("emu"))
@@ -88,7 +89,7 @@ func TestShuffle(t *testing.T) {
 }
 
 func TestRemove(t *testing.T) {
-	q := newQueue(ytdlp.NewClient("", ""))
+	q := newQueue(ytdlp.NewClient(ytdlp.ClientConfig{}), context.Background)
 	q.l.PushBack(testAudioTrack("fox"))
 	q.l.PushBack(testAudioTrack("yak"))
 	q.l.PushBack(testAudioTrack("emu"))
@@ -1,7 +1,7 @@
 package voice
 
 import (
-	"bytes"
+	"container/list"
 	"context"
 	"errors"
 	"fmt"
@@ -28,11 +28,15 @@ import (
 const (
 	defaultSleep             = 1 * time.Second
 	defaultInactivityTimeout = 5 * time.Minute
+	defaultResolveTimeout    = 5 * time.Minute
+	// Tracks longer than this aren't queued
+	maxTrackLength = 3 * time.Hour
 )
 
 var (
 	empty            = struct{}{}
 	ErrSessionClosed = fmt.Errorf("session is closed")
+	ErrLiveSeek      = errors.New("cannot seek a live stream")
 )
 
 type session struct {
@@ -66,10 +70,12 @@ type session struct {
 	np *ytdlp.Track
 	// Specific log for this session
 	log zerolog.Logger
-	// Playing is the only operation which can block for
-	// long periods of time so we keep track of it's cancel
-	// func so we can cancel the operation so we can leave etc.
-	playCancelFunc context.CancelFunc
+	// Resolving tracks is the only operation which can block
+	// for long periods of time, so every resolve uses this ctx
+	// which is cancelled when we leave or the queue is cleared
+	resolveMu     sync.Mutex
+	resolveCtx    context.Context
+	cancelResolve context.CancelFunc
 	// Manager so that the session can delete itself
 	// from the manager if needed
 	manager *Manager
@@ -87,17 +93,17 @@ func newSession(s *state.State, yt *ytdlp.Client, m *Manager) (*session, error)
 	}
 
 	ss := &session{
-		state:          s,
-		manager:        m,
-		voice:          v,
-		yt:             yt,
-		queue:          newQueue(yt),
-		decoder:        ogg.NewDecoder(),
-		abort:          make(chan struct{}),
-		skip:           make(chan struct{}),
-		cancelPipe:     func() {},
-		playCancelFunc: func() {},
-	}
+		state:      s,
+		manager:    m,
+		voice:      v,
+		yt:         yt,
+		decoder:    ogg.NewDecoder(),
+		abort:      make(chan struct{}),
+		skip:       make(chan struct{}),
+		cancelPipe: func() {},
+	}
+	ss.resolveCtx, ss.cancelResolve = context.WithCancel(context.Background())
+	ss.queue = newQueue(yt, ss.lookups)
 
 	go ss.processSignals()
 	go ss.processVoice()
@@ -128,6 +134,31 @@ func (s *session) sendMessage(content string, embeds ...discord.Embed) {
 	}
 }
 
+// resolving returns the ctx to resolve tracks with, it's
+// cancelled by cancelResolving
+func (s *session) resolving() (context.Context, context.CancelFunc) {
+	s.resolveMu.Lock()
+	defer s.resolveMu.Unlock()
+	return context.WithTimeout(s.resolveCtx, defaultResolveTimeout)
+}
+
+// lookups returns the ctx which queued placeholders are searched for
+// with, it's cancelled by cancelResolving like the ctx of resolving
+func (s *session) lookups() context.Context {
+	s.resolveMu.Lock()
+	defer s.resolveMu.Unlock()
+	return s.resolveCtx
+}
+
+// cancelResolving stops the tracks which are being resolved and
+// the searches for queued placeholders
+func (s *session) cancelResolving() {
+	s.resolveMu.Lock()
+	defer s.resolveMu.Unlock()
+	s.cancelResolve()
+	s.resolveCtx, s.cancelResolve = context.WithCancel(context.Background())
+}
+
 func (s *session) leaveDueToInactivity() {
 	s.sendMessage("Leaving voice due to inactivity")
 	s.log.Debug().Msg("leaving voice due to inactivity")
@@ -199,14 +230,20 @@ func (s *session) processVoice() {
 		sleeping = 0
 		ctx, cancel := context.WithCancel(context.Background())
 		s.cancelPipe = cancel
-		s.log.Debug().Str("title", t.VideoTitle).Str("url", t.URL).Msg("playing track")
+		s.log.Debug().Str("id", t.LogID()).Str("title", t.VideoTitle).Str("url", t.URL).Msg("playing track")
 		err = s.pipeVoice(ctx, t)
-		s.log.Debug().Err(err).Str("title", t.VideoTitle).Str("url", t.Uploader).Msg("track done")
-		if err != nil && !isSignalKilled(err) && !isClosedConn(err) {
+		t.Abort() // Stops the download if it's still running
+		s.log.Debug().Err(err).Str("id", t.LogID()).Str("title", t.VideoTitle).Str("url", t.Uploader).Msg("track done")
+		if errors.Is(err, ytdlp.ErrNoMatch) {
+			// Placeholder tracks are only searched for once they're
+			// near the front of the queue so they can still be missing
+			s.sendMessage(fmt.Sprintf("Skipping: %s - couldn't find it on YouTube", t.Pretty()))
+			s.log.Warn().Err(err).Str("id", t.LogID()).Str("title", t.Title).Str("artist", t.Artist).Msg("skipped unresolved track")
+		} else if err != nil && !isSignalKilled(err) && !isClosedConn(err) {
 			// Only log the error if the process wasn't killed manually by us
 			// or due to the connection already being closed
 			s.sendMessage(fmt.Sprintf("Error playing: %s", t.Pretty()))
-			s.log.Error().Err(err).Msg("failed to pipe track")
+			s.log.Error().Err(err).Str("id", t.LogID()).Msg("failed to pipe track")
 		}
 		s.cancelPipe()
 	}
@@ -222,13 +259,13 @@ func (s *session) pipeVoice(ctx context.Context, t *ytdlp.Track) error {
 	// Tells discord we are about to send the play message
 	s.sendTyping()
 
-	// Download the file
+	// Wait for the file to start downloading
 	audio, ok := <-t.FileChan()
 	if !ok {
 		return errors.New("file chan closed (shouldn't happen here)")
 	}
-	if audio == nil {
-		return errors.New("file failed to download")
+	if err := audio.Wait(ctx, 1); err != nil {
+		return fmt.Errorf("file failed to download: %w", err)
 	}
 
 	// Stream the audio towards the voice state
@@ -237,16 +274,41 @@ func (s *session) pipeVoice(ctx context.Context, t *ytdlp.Track) error {
 		s.np = t
 		s.mu.RUnlock()
 
-		s.sendMessage("Playing: " + t.Pretty())
+		if sub := t.Substitute(); sub != nil {
+			// The track couldn't be downloaded so we say what's playing instead
+			s.sendMessage(fmt.Sprintf("Playing: %s - couldn't play %s", sub.Pretty(), t.Pretty()))
+		} else {
+			s.sendMessage("Playing: " + t.Pretty())
+		}
 		if err := s.voice.Speaking(ctx, voicegateway.Microphone); err != nil {
 			return err
 		}
-		if err := s.decoder.Decode(ctx, s.voice, bytes.NewReader(audio)); err != nil {
+
+		events, unsubscribe := s.decoder.Subscribe()
+		watched := make(chan bool)
+		go func() {
+			watched <- s.watchDecoder(ctx, t, events)
+		}()
+		titleCtx, stopTitles := context.WithCancel(ctx)
+		if t.Live {
+			go s.watchTitles(titleCtx, t)
+		}
+		err := s.decoder.Decode(ctx, s.voice, audio.NewReader(ctx))
+		stopTitles()
+		unsubscribe()
+		finished := <-watched
+		s.setSpeaking(ctx, voicegateway.NotSpeaking)
+
+		if b, p := s.decoder.Skipped(); p > 0 {
+			s.log.Warn().Int64("bytes", b).Int64("pages", p).Str("title", t.VideoTitle).Msg("skipped corrupt ogg pages")
+		}
+		if err != nil {
 			return err
 		}
 
-		// Play the track again if we're looping
-		if s.loop {
+		// Play the track again if we're looping, unless it was skipped,
+		// live streams can't be played again since they're not kept
+		if s.loop && finished && !t.Live {
 			ctx, s.cancelPipe = context.WithCancel(context.Background())
 			s.log.Debug().Str("title", t.VideoTitle).Str("url", t.URL).Msg("looping track")
 			continue
@@ -256,6 +318,47 @@ func (s *session) pipeVoice(ctx context.Context, t *ytdlp.Track) error {
 	}
 }
 
+// watchDecoder follows the decoder's events whilst the track is playing,
+// it returns whether the track was played until the end. We only speak
+// whilst the decoder is writing packets
+func (s *session) watchDecoder(ctx context.Context, t *ytdlp.Track, events <-chan ogg.Event) bool {
+	var finished bool
+	for e := range events {
+		switch e.Type {
+		case ogg.EventSeek:
+			s.log.Debug().Dur("position", e.Position).Str("title", t.VideoTitle).Msg("seeked track")
+		case ogg.EventPause:
+			s.log.Debug().Dur("position", e.Position).Str("title", t.VideoTitle).Msg("paused track")
+			s.setSpeaking(ctx, voicegateway.NotSpeaking)
+		case ogg.EventResume:
+			s.log.Debug().Dur("position", e.Position).Str("title", t.VideoTitle).Msg("resumed track")
+			s.setSpeaking(ctx, voicegateway.Microphone)
+		case ogg.EventEOF:
+			finished = true
+		}
+	}
+	return finished
+}
+
+// watchTitles announces the songs played on a live stream
+func (s *session) watchTitles(ctx context.Context, t *ytdlp.Track) {
+	for {
+		select {
+		case title := <-t.Titles():
+			s.log.Debug().Str("title", title).Str("url", t.URL).Msg("live stream title changed")
+			s.sendMessage(fmt.Sprintf("Playing: `%s` on %s", title, t.Pretty()))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *session) setSpeaking(ctx context.Context, flag voicegateway.SpeakingFlag) {
+	if err := s.voice.Speaking(ctx, flag); err != nil && ctx.Err() == nil {
+		s.log.Error().Err(err).Msg("failed to set speaking state")
+	}
+}
+
 // Commands
 
 func (s *session) Join(ctx SessionContext) error {
@@ -283,8 +386,8 @@ func (s *session) Join(ctx SessionContext) error {
 func (s *session) Leave() error {
 	// Signify the session is closing
 	s.closing = true
-	// Stop any playing blocking the processing
-	s.playCancelFunc()
+	// Stop any tracks being resolved
+	s.cancelResolving()
 
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -321,78 +424,143 @@ func (s *session) Leave() error {
 	return leaveErr
 }
 
+// Play queues the tracks from the link/text, tracks of playlists from
+// other services are placeholders which are searched for once they near
+// the front of the queue
 func (s *session) Play(ctx SessionContext, next bool) (string, error) {
 	s.mu.RLock()
-	defer s.mu.RUnlock()
 	if s.closing {
+		s.mu.RUnlock()
 		return "", ErrSessionClosed
 	}
 
 	// Join the voice channel if needed
 	err := s.Join(ctx)
 	if err != nil {
+		s.mu.RUnlock()
 		return "", err
 	}
 
 	s.ctx = ctx // We still need to set the context
+	s.mu.RUnlock()
 
-	// Retrieve the track(s)
-	dlCtx, cancelFunc := context.WithTimeout(context.Background(), 5*time.Minute)
-	s.playCancelFunc = cancelFunc
-	defer cancelFunc()
+	// Retrieve the track(s), we don't hold the mutex whilst
+	// they're resolved so the current track keeps playing
+	dlCtx, cancel := s.resolving()
+	defer cancel()
 	tracks, err := s.yt.DownloadMetadata(dlCtx, ctx.FirstArg())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return "", ErrSessionClosed
+	}
 	if err != nil {
+		if dlCtx.Err() != nil {
+			return "Error Encountered...", err
+		}
 		return "", fmt.Errorf("error finding track from link/text: %w", err)
 	}
 	if len(tracks) == 0 {
 		return "No tracks found", errors.New("no tracks found")
 	}
-	if dlCtx.Err() != nil {
-		return "Error Encountered...", dlCtx.Err()
-	}
 
-	// We need to check if the queue is empty before we enqueue so we can decide
-	// what message to send to the user later
-	queueEmpty := s.queue.Len() == 0
-	playingTrack := s.np != nil
+	q := s.newQueuer(next)
+	for _, t := range tracks {
+		q.push(t)
+	}
+	return q.reply(), nil
+}
 
-	// Anonymous function to simplify queueing
-	qtrack := func(t *ytdlp.Track) {
-		if next {
-			s.queue.PushFront(t)
-		} else {
-			s.queue.PushBack(t)
-		}
+// Enqueue queues tracks which have already been found, e.g. a search result
+func (s *session) Enqueue(ctx SessionContext, tracks []*ytdlp.Track, next bool) (string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closing {
+		return "", ErrSessionClosed
 	}
 
-	// Reply and queueing behaviour if only one track returned
-	if len(tracks) == 1 {
-		t := tracks[0]
-		if t.Duration > time.Hour*3 {
-			return fmt.Sprintf("Could not queue: %s - track is above 3 hours\n", t.Pretty()), nil
-		} else {
-			qtrack(t)
-			if queueEmpty && !playingTrack {
-				return "Queued: `1` track", nil
-			}
-			return fmt.Sprintf("Queued: %s", t.Pretty()), nil
-		}
+	// Join the voice channel if needed
+	err := s.Join(ctx)
+	if err != nil {
+		return "", err
 	}
+	s.ctx = ctx
 
-	// Reply and queueing if more than one track is returned
-	failed := 0
+	q := s.newQueuer(next)
 	for _, t := range tracks {
-		if t.Duration > time.Hour*3 {
-			failed++
-		} else {
-			s.log.Debug().Str("title", t.VideoTitle).Str("url", t.URL).Msg("queued track")
-			qtrack(t)
+		q.push(t)
+	}
+	return q.reply(), nil
+}
+
+// queuer queues the tracks of a single command and
+// creates the reply for the user once they're queued
+type queuer struct {
+	s    *session
+	next bool
+	// Whether the queue was empty and nothing was playing
+	// before we queued, it decides the reply we send
+	idle bool
+	// The last track queued next, the others go after it
+	mark *list.Element
+	// The first track found, it's used in the reply if
+	// only one track is queued
+	first *ytdlp.Track
+	// found  - how many tracks have been pushed
+	// queued - how many of them were queued
+	// long   - how many of them were too long to queue
+	found, queued, long int
+}
+
+// newQueuer must be called with the session's mutex held
+func (s *session) newQueuer(next bool) *queuer {
+	return &queuer{
+		s:    s,
+		next: next,
+		idle: s.queue.Len() == 0 && s.np == nil,
+	}
+}
+
+// push queues the track, it must be called with the session's mutex held
+func (q *queuer) push(t *ytdlp.Track) {
+	q.found++
+	if q.first == nil {
+		q.first = t
+	}
+	if t.Duration > maxTrackLength {
+		q.long++
+		return
+	}
+
+	if q.next {
+		q.mark = q.s.queue.PushAfter(q.mark, t)
+	} else {
+		q.s.queue.PushBack(t)
+	}
+	q.queued++
+	q.s.log.Debug().Str("title", t.VideoTitle).Str("url", t.URL).Msg("queued track")
+}
+
+// reply is the message for the user once the tracks are queued
+func (q *queuer) reply() string {
+	// Reply if only one track was returned
+	if q.found == 1 {
+		if q.long > 0 {
+			return fmt.Sprintf("Could not queue: %s - track is above 3 hours\n", q.first.Pretty())
+		}
+		if q.idle {
+			return "Queued: `1` track"
 		}
+		return fmt.Sprintf("Queued: %s", q.first.Pretty())
 	}
-	if failed > 0 {
-		return fmt.Sprintf("Queued: `%d` tracks - `%d` failed\n", len(tracks), failed), nil
+
+	// Reply if more than one track was returned
+	resp := fmt.Sprintf("Queued: `%d` tracks", q.queued)
+	if q.long > 0 {
+		resp += fmt.Sprintf(" - `%d` failed", q.long)
 	}
-	return fmt.Sprintf("Queued: `%d` tracks\n", len(tracks)), nil
+	return resp + "\n"
 }
 
 func (s *session) Pause() {
@@ -437,11 +605,20 @@ func (s *session) Seek(ctx SessionContext) (time.Duration, error) {
 		return 0, ErrSessionClosed
 	}
 
+	if s.np != nil && s.np.Live {
+		return 0, ErrLiveSeek
+	}
+
 	t, err := parse.Duration(ctx.FirstArg())
 	if err != nil {
 		return 0, err
 	}
-	return t, s.decoder.Seek(t)
+	err = s.decoder.Seek(t)
+	if err != nil {
+		return t, err
+	}
+	// We seek to the start of a page so we might be slightly before t
+	return s.decoder.Time(), nil
 }
 
 func (s *session) Queue(page int) (string, error) {
@@ -468,7 +645,7 @@ func (s *session) Queue(page int) (string, error) {
 		total += t.Duration
 		if i >= start && i <= end {
 			resp.WriteString(fmt.Sprintf("%d. %s\n", i+1, fmt.Sprintf("%s (%s)`",
-				t.Pretty(), pretty.Duration(t.Duration))))
+				t.Pretty(), trackLength(t))))
 		}
 	}
 	resp.WriteRune('\n')
@@ -487,11 +664,24 @@ func (s *session) NowPlaying() (string, error) {
 		return "No track currently playing", nil
 	}
 
+	// The decoder's clock is read directly since position
+	// events are only emitted once a second
+	elapsed := pretty.Duration(s.decoder.Position())
+	if s.np.Live {
+		resp := fmt.Sprintf("`%s` by `%s` - `%s` `LIVE`\n", s.np.VideoTitle, s.np.Uploader, elapsed)
+		if title := s.np.StreamTitle(); title != "" {
+			resp += fmt.Sprintf("Now playing: `%s`\n", title)
+		}
+		return resp, nil
+	}
 	return fmt.Sprintf("`%s` by `%s` - `%s`/`%s`\n", s.np.VideoTitle, s.np.Uploader,
-		pretty.Duration(s.decoder.Time), pretty.Duration(s.np.Duration)), nil
+		elapsed, pretty.Duration(s.np.Duration)), nil
 }
 
 func (s *session) ClearQueue() {
+	// Tracks still being resolved would be queued after clearing
+	s.cancelResolving()
+
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	if s.closing {
@@ -548,9 +738,17 @@ func (s *session) Shuffle() {
 
 // Util
 
+// trackLength formats the duration of the track, live tracks don't have one
+func trackLength(t *ytdlp.Track) string {
+	if t.Live {
+		return "LIVE"
+	}
+	return pretty.Duration(t.Duration)
+}
+
 func isSignalKilled(err error) bool {
-	exitErr, ok := err.(*exec.ExitError)
-	if !ok {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
 		return false
 	}
 	sig := exitErr.Sys().(syscall.WaitStatus).Signal().String()
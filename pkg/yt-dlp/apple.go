@@ -0,0 +1,145 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// appleLookupAPI is the itunes lookup api, it doesn't need a token
+const appleLookupAPI = "https://itunes.apple.com/lookup"
+
+// appleResolver looks up apple music links and then
+// searches for the tracks on youtube
+type appleResolver struct{}
+
+func (appleResolver) Name() string {
+	return "apple music"
+}
+
+func (appleResolver) Match(u *url.URL) bool {
+	switch hostname(u) {
+	case "music.apple.com", "geo.music.apple.com", "itunes.apple.com":
+		return true
+	}
+	return false
+}
+
+func (r appleResolver) Resolve(ctx context.Context, c *Client, u *url.URL) ([]*Track, error) {
+	return resolveInfos(ctx, c, r, u)
+}
+
+func (appleResolver) infos(ctx context.Context, c *Client, u *url.URL) ([]trackInfo, error) {
+	link, err := parseAppleLink(u)
+	if err != nil {
+		return nil, err
+	}
+
+	// Playlists can't be looked up so they're read from their page
+	if link.kind == "playlist" {
+		return c.pageInfos(ctx, u.String())
+	}
+	return c.appleInfos(ctx, link)
+}
+
+// appleLink is what an apple music link points to
+type appleLink struct {
+	kind    string
+	id      string
+	country string
+}
+
+// parseAppleLink parses links such as /us/album/name/id, the songs
+// of albums are linked to with the song's id in the "i" query
+func parseAppleLink(u *url.URL) (appleLink, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	var link appleLink
+	if len(parts) > 0 && len(parts[0]) == 2 {
+		link.country = parts[0]
+		parts = parts[1:]
+	}
+	if len(parts) < 2 {
+		return link, errors.New("invalid apple music link type")
+	}
+
+	// The id is last, the name before it is optional
+	link.kind = parts[0]
+	link.id = parts[len(parts)-1]
+	switch link.kind {
+	case "song":
+	case "album":
+		if i := u.Query().Get("i"); i != "" {
+			link.kind, link.id = "song", i
+		}
+	case "playlist":
+		return link, nil
+	default:
+		return link, errors.New("invalid apple music link type")
+	}
+
+	// Songs and albums are looked up by their numeric id which is
+	// prefixed by "id" on older itunes links
+	link.id = strings.TrimPrefix(link.id, "id")
+	if _, err := strconv.ParseUint(link.id, 10, 64); err != nil {
+		return link, errors.New("invalid apple music id: " + link.id)
+	}
+	return link, nil
+}
+
+type appleResult struct {
+	WrapperType string `json:"wrapperType"`
+	Kind        string `json:"kind"`
+	ArtistName  string `json:"artistName"`
+	TrackName   string `json:"trackName"`
+	TrackTime   int64  `json:"trackTimeMillis"`
+	DiscNumber  int    `json:"discNumber"`
+	TrackNumber int    `json:"trackNumber"`
+}
+
+func (c *Client) appleInfos(ctx context.Context, link appleLink) ([]trackInfo, error) {
+	q := url.Values{"id": {link.id}}
+	if link.kind == "album" {
+		q.Set("entity", "song")
+	}
+	if link.country != "" {
+		q.Set("country", link.country)
+	}
+
+	var resp struct {
+		Results []appleResult `json:"results"`
+	}
+	if err := c.getJSON(ctx, appleLookupAPI+"?"+q.Encode(), &resp); err != nil {
+		return nil, err
+	}
+
+	// Albums are returned with their songs, which we want in album order
+	songs := make([]appleResult, 0, len(resp.Results))
+	for _, r := range resp.Results {
+		if r.WrapperType == "track" && r.Kind == "song" {
+			songs = append(songs, r)
+		}
+	}
+	sort.SliceStable(songs, func(i, j int) bool {
+		if songs[i].DiscNumber != songs[j].DiscNumber {
+			return songs[i].DiscNumber < songs[j].DiscNumber
+		}
+		return songs[i].TrackNumber < songs[j].TrackNumber
+	})
+
+	infos := make([]trackInfo, len(songs))
+	for i, s := range songs {
+		infos[i] = trackInfo{
+			Artists:  []string{s.ArtistName},
+			Title:    s.TrackName,
+			Duration: time.Duration(s.TrackTime) * time.Millisecond,
+		}
+	}
+	if len(infos) == 0 {
+		return nil, errors.New("apple music: no tracks found")
+	}
+	return infos, nil
+}
@@ -0,0 +1,244 @@
+package ytdlp
+
+import (
+	"container/list"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// cacheExt is the extension of the encoded tracks in the cache
+	cacheExt = ".opus"
+	// cacheTempPrefix marks files which are still being written
+	cacheTempPrefix = ".tmp-"
+)
+
+// Cache stores encoded tracks on disk so they don't have to be downloaded
+// again, the least recently used tracks are evicted once it's full
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	size int64
+	// lru holds the entries with the most recently used at the front
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// cacheEntry is a track stored in the cache
+type cacheEntry struct {
+	name string
+	size int64
+}
+
+// NewCache opens the cache in the dir, creating it if it doesn't exist.
+// Tracks are evicted once their total size is over maxSize bytes
+func NewCache(dir string, maxSize int64) (*Cache, error) {
+	if maxSize <= 0 {
+		return nil, errors.New("cache size must be positive")
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	// Files are used in the order of their modification time, we
+	// touch them whenever they're used so the order is persisted
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type file struct {
+		name string
+		size int64
+		used time.Time
+	}
+	var files []file
+	for _, de := range des {
+		if !de.Type().IsRegular() {
+			continue
+		}
+		name := de.Name()
+		if strings.HasPrefix(name, cacheTempPrefix) {
+			// We crashed whilst writing this file
+			os.Remove(filepath.Join(dir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, cacheExt) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{name: name, size: info.Size(), used: info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].used.After(files[j].used) })
+	for _, f := range files {
+		c.entries[f.name] = c.lru.PushBack(&cacheEntry{name: f.name, size: f.size})
+		c.size += f.size
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.evict()
+	return c, nil
+}
+
+// Open returns the cached track with the key, ok is false if it isn't cached
+func (c *Cache) Open(key string) (f *os.File, ok bool) {
+	name := cacheName(key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[name]
+	if !ok {
+		return nil, false
+	}
+	path := filepath.Join(c.dir, name)
+	f, err := os.Open(path)
+	if err != nil {
+		// The file was removed from under us
+		c.remove(e)
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	c.lru.MoveToFront(e)
+	return f, true
+}
+
+// Create returns a writer for the track with the key, the track is only
+// added to the cache once it's committed so partial tracks are never cached
+func (c *Cache) Create(key string) (*CacheWriter, error) {
+	f, err := os.CreateTemp(c.dir, cacheTempPrefix+"*")
+	if err != nil {
+		return nil, err
+	}
+	return &CacheWriter{c: c, f: f, name: cacheName(key)}, nil
+}
+
+// Size returns the total size of the cached tracks in bytes
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.size
+}
+
+// add inserts the track which has been written to the dir into the cache
+func (c *Cache) add(name string, size int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[name]; ok {
+		c.size -= e.Value.(*cacheEntry).size
+		c.lru.Remove(e)
+	}
+	c.entries[name] = c.lru.PushFront(&cacheEntry{name: name, size: size})
+	c.size += size
+	c.evict()
+}
+
+// evict removes the least recently used tracks until the cache
+// fits in its max size, the lock must be held when calling it
+func (c *Cache) evict() {
+	for c.size > c.maxSize && c.lru.Len() > 0 {
+		e := c.lru.Back()
+		os.Remove(filepath.Join(c.dir, e.Value.(*cacheEntry).name))
+		c.remove(e)
+	}
+}
+
+// remove deletes the entry, the lock must be held when calling it
+func (c *Cache) remove(e *list.Element) {
+	entry := e.Value.(*cacheEntry)
+	c.size -= entry.size
+	c.lru.Remove(e)
+	delete(c.entries, entry.name)
+}
+
+// CacheWriter writes a track into the cache, it must
+// be either committed or aborted once it's written
+type CacheWriter struct {
+	c    *Cache
+	f    *os.File
+	name string
+	size int64
+}
+
+func (w *CacheWriter) Write(p []byte) (int, error) {
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Commit adds the track to the cache, it's renamed into place
+// so the cache never contains a partially written track
+func (w *CacheWriter) Commit() error {
+	err := w.f.Sync()
+	if err == nil {
+		err = w.f.Close()
+	} else {
+		w.f.Close()
+	}
+	if err == nil {
+		err = os.Rename(w.f.Name(), filepath.Join(w.c.dir, w.name))
+	}
+	if err != nil {
+		os.Remove(w.f.Name())
+		return err
+	}
+
+	w.c.add(w.name, w.size)
+	return nil
+}
+
+// Abort discards the track
+func (w *CacheWriter) Abort() {
+	w.f.Close()
+	os.Remove(w.f.Name())
+}
+
+// cacheName returns the name of the file the track with the key is stored in
+func cacheName(key string) string {
+	return url.PathEscape(key) + cacheExt
+}
+
+// cacheTee copies what's read from the stream into the cache, if writing
+// to the cache fails then the stream can still be read from
+type cacheTee struct {
+	s   io.Reader
+	cw  *CacheWriter
+	key string
+	err error
+}
+
+func (t *cacheTee) Read(p []byte) (int, error) {
+	n, err := t.s.Read(p)
+	if n > 0 && t.err == nil {
+		if _, t.err = t.cw.Write(p[:n]); t.err != nil {
+			log.Error().Err(t.err).Str("key", t.key).Msg("failed to cache track")
+		}
+	}
+	return n, err
+}
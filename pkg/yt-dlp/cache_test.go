@@ -0,0 +1,128 @@
+package ytdlp
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func cacheTrack(t *testing.T, c *Cache, key, data string) {
+	t.Helper()
+
+	w, err := c.Create(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func isCached(c *Cache, key string) bool {
+	f, ok := c.Open(key)
+	if ok {
+		f.Close()
+	}
+	return ok
+}
+
+func TestCache(t *testing.T) {
+	c, err := NewCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if isCached(c, "youtube-a") {
+		t.Error("empty cache returned a track")
+	}
+	cacheTrack(t, c, "youtube-a", "aaaa")
+	f, ok := c.Open("youtube-a")
+	if !ok {
+		t.Fatal("track wasn't cached")
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "aaaa" {
+		t.Errorf("invalid track: %q", data)
+	}
+
+	// Aborted tracks leave nothing behind
+	w, err := c.Create("youtube-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("bbbb"))
+	w.Abort()
+	if isCached(c, "youtube-b") {
+		t.Error("aborted track was cached")
+	}
+	des, err := os.ReadDir(c.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(des) != 1 {
+		t.Errorf("expected 1 file in the cache but found %d", len(des))
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	c, err := NewCache(t.TempDir(), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Using a track stops it from being the next to be evicted
+	cacheTrack(t, c, "youtube-a", "aaaa")
+	cacheTrack(t, c, "youtube-b", "bbbb")
+	isCached(c, "youtube-a")
+	cacheTrack(t, c, "youtube-c", "cccc")
+	if isCached(c, "youtube-b") {
+		t.Error("least recently used track wasn't evicted")
+	}
+	if !isCached(c, "youtube-a") || !isCached(c, "youtube-c") {
+		t.Error("recently used track was evicted")
+	}
+	if c.Size() != 8 {
+		t.Errorf("expected size of 8 but got %d", c.Size())
+	}
+}
+
+func TestCacheReopen(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewCache(dir, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheTrack(t, c, "youtube-a", "aaaa")
+	cacheTrack(t, c, "youtube-b", "bbbb")
+
+	// Make sure the modification times differ
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(dir, cacheName("youtube-b")), old, old)
+	if err := os.WriteFile(filepath.Join(dir, cacheTempPrefix+"1"), []byte("x"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Leftover temp files are removed and the order is kept
+	c, err = NewCache(dir, 6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, cacheTempPrefix+"1")); !os.IsNotExist(err) {
+		t.Error("temp file wasn't removed")
+	}
+	if isCached(c, "youtube-b") {
+		t.Error("least recently used track wasn't evicted")
+	}
+	if !isCached(c, "youtube-a") {
+		t.Error("recently used track was evicted")
+	}
+}
@@ -1,12 +1,11 @@
 package ytdlp
 
 import (
-	"bytes"
 	"context"
-	"errors"
+	"io"
+	"net/http"
 	"net/url"
-	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -14,23 +13,140 @@ import (
 	"golang.org/x/time/rate"
 )
 
-const MaxRequestsPerSec = 3
+const (
+	MaxRequestsPerSec = 3
+	// DefaultCacheSize is the size of the track cache in MB
+	// if $CACHE_SIZE isn't given
+	DefaultCacheSize = 1024
+)
 
 type Client struct {
+	cfg     ClientConfig
 	rl      *rate.Limiter
 	spotify *spotifyClient
+	// resolvers turn urls into tracks, they're consulted in order,
+	// the fallback is used if none of them handle the url
+	resolvers []Resolver
+	fallback  Resolver
+	// http downloads tracks which yt-dlp isn't needed for
+	http *http.Client
+	// cache stores the encoded tracks, it's nil if caching is disabled
+	cache *Cache
+	// library is the local music, it's nil if there isn't any
+	library *Library
+	// matches are the videos tracks from other services were matched to
+	matches *Matches
+	// backoff is how long until failed downloads are first retried
+	backoff time.Duration
 }
 
-func NewClient(spotifyID, spotifySecret string) *Client {
+func NewClient(cfg ClientConfig) *Client {
+	cfg = cfg.withDefaults()
 	c := &Client{
-		rl:      rate.NewLimiter(rate.Every(time.Second/time.Duration(MaxRequestsPerSec)), 1),
-		spotify: newSpotifyClient(spotifyID, spotifySecret),
+		cfg:       cfg,
+		rl:        rate.NewLimiter(rate.Every(time.Second/time.Duration(MaxRequestsPerSec)), 1),
+		resolvers: defaultResolvers(),
+		fallback:  directResolver{},
+		http:      newHTTPClient(cfg.Proxy, cfg.AllowPrivateHosts),
+		backoff:   defaultBackoff,
+	}
+	if cfg.SpotifyID != "" && cfg.SpotifySecret != "" {
+		c.spotify = newSpotifyClient(cfg)
+	}
+
+	// Tracks are only cached if we have somewhere to put them
+	if cfg.CacheDir != "" {
+		cache, err := NewCache(cfg.CacheDir, cfg.CacheSize*1024*1024)
+		if err != nil {
+			log.Error().Err(err).Str("dir", cfg.CacheDir).Msg("failed to open the track cache")
+		} else {
+			c.cache = cache
+		}
+	}
+
+	// Matches are only kept in memory if they can't be loaded
+	matches, err := NewMatches(cfg.MatchCache, cfg.MatchTTL)
+	if err != nil {
+		log.Error().Err(err).Str("path", cfg.MatchCache).Msg("failed to load the saved matches")
+		matches, _ = NewMatches("", cfg.MatchTTL)
+	}
+	c.matches = matches
+
+	// The library is scanned in the background since probing
+	// every file can take a while, the old index is used until then
+	if dir := cfg.LibraryDir; dir != "" {
+		index := cfg.LibraryIndex
+		if index == "" {
+			index = filepath.Join(dir, ".surf-library.json")
+		}
+		library, err := NewLibrary(dir, index)
+		if err != nil {
+			log.Error().Err(err).Str("dir", dir).Msg("failed to open the library")
+		} else {
+			library.probe = func(ctx context.Context, path string) (LibraryEntry, error) {
+				return ffprobe(ctx, cfg.Executor, cfg.FFprobePath, path)
+			}
+			c.library = library
+			go func() {
+				err := library.Scan(context.Background())
+				if err != nil {
+					log.Error().Err(err).Str("dir", dir).Msg("failed to scan the library")
+				} else {
+					log.Info().Int("tracks", library.Len()).Msg("scanned the library")
+				}
+			}()
+		}
 	}
 
 	return c
 }
 
+// Close saves the matches which haven't been saved yet
+func (c *Client) Close() error {
+	return c.matches.Flush()
+}
+
+// newHTTPClient returns a client which uses the proxy if it's set, it
+// can't connect to private addresses unless allowPrivate is true
+func newHTTPClient(p string, allowPrivate bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	var proxy *url.URL
+	if p != "" {
+		var err error
+		proxy, err = url.Parse(p)
+		if err != nil {
+			log.Error().Err(err).Str("proxy", p).Msg("invalid proxy given")
+			proxy = nil
+		}
+	}
+	if proxy != nil {
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+	if allowPrivate {
+		return &http.Client{Transport: transport}
+	}
+
+	// The proxy may be on the private network itself, but
+	// it connects to the hosts so they're checked beforehand
+	var proxyAddr string
+	if proxy != nil {
+		proxyAddr = proxyHostPort(proxy)
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			if err := checkPublicHost(req.Context(), req.URL.Hostname()); err != nil {
+				return nil, err
+			}
+			return proxy, nil
+		}
+	}
+	transport.DialContext = publicDialer(proxyAddr)
+	return &http.Client{Transport: transport}
+}
+
 func (c *Client) DownloadMetadata(ctx context.Context, text string) ([]*Track, error) {
+	if query, ok := cutPrefixFold(text, LibraryPrefix); ok {
+		return c.searchLibrary(query)
+	}
+
 	url, err := url.ParseRequestURI(text)
 
 	// If we don't have a proper URL we treat the query as a search
@@ -44,82 +160,87 @@ func (c *Client) DownloadMetadata(ctx context.Context, text string) ([]*Track, e
 
 	log.Debug().Str("query", text).Str("host", url.Host).Msg("valid url received")
 
-	// Ensure the URL is from a valid domain
-	isSpotify := strings.HasSuffix(url.Host, "spotify.com")
-	isSoundcloud := url.Host == "soundcloud.com"
-	isBandcamp := strings.HasSuffix(url.Host, ".bandcamp.com")
-	isYouTube := url.Host == "youtu.be" || url.Host == "www.youtube.com"
-	if !(isSoundcloud || isSpotify || isBandcamp || isYouTube) {
-		return nil, errors.New("url is from an unsupported domain")
+	r, err := c.resolver(url)
+	if err != nil {
+		return nil, err
 	}
+	log.Debug().Str("query", text).Str("resolver", r.Name()).Msg("resolving url")
+	return r.Resolve(ctx, c, url)
+}
 
-	// If we don't have a spotify URL we treat it as just a link
-	if !isSpotify {
-		tracks, err := c.searchLink(ctx, text)
-		if err != nil {
-			return nil, err
-		}
-		return tracks, nil
+// DownloadFile downloads the track at the url and writes it to w as
+// an opus encoded ogg stream, it's written as soon as it's encoded
+func (c *Client) DownloadFile(ctx context.Context, url string, w io.Writer) error {
+	s, err := c.Stream(ctx, url)
+	if err != nil {
+		return err
 	}
+	defer s.Close()
 
-	// If it is a spotify URL we attempt to download the tracks' metadata
-	// and then search on yt using said metadata
-	if c.spotify == nil {
-		return nil, errors.New("spotify is unsupported")
-	}
+	_, err = io.Copy(w, s)
+	return err
+}
 
-	queries, err := c.spotify.Download(ctx, text)
-	if err != nil {
-		return nil, err
+// DownloadTrack writes the track to w as an opus encoded ogg stream, it's
+// read from the cache if it's been downloaded before. Otherwise it's
+// downloaded like DownloadFile and saved to the cache as it's written
+func (c *Client) DownloadTrack(ctx context.Context, t *Track, w io.Writer) error {
+	if err := c.resolvePlaceholder(ctx, t); err != nil {
+		return err
 	}
 
-	tracks := make([]*Track, 0)
-	for _, q := range queries {
-		t, err := c.searchSpotify(ctx, q)
-		if err != nil {
-			log.Error().Err(err).Interface("track", t).Msg("failed to search for spotify track with yt-dlp")
+	if t.direct || t.file != "" {
+		var s *Stream
+		var err error
+		if t.file != "" {
+			s, err = c.streamFile(ctx, t.file)
 		} else {
-			tracks = append(tracks, t)
+			s, err = c.streamDirect(ctx, t)
+		}
+		if err != nil {
+			return err
 		}
+		defer s.Close()
+
+		_, err = io.Copy(w, s)
+		return err
 	}
 
-	if len(tracks) == 0 {
-		return nil, errors.New("no tracks found")
+	key := t.cacheKey()
+	if c.cache == nil || key == "" {
+		return c.DownloadFile(ctx, t.URL, w)
 	}
-	return tracks, nil
-}
 
-func (c *Client) DownloadFile(ctx context.Context, url string) ([]byte, error) {
-	err := c.rl.Wait(ctx)
-	if err != nil {
-		return nil, err
+	if f, ok := c.cache.Open(key); ok {
+		defer f.Close()
+		log.Trace().Str("key", key).Msg("track is cached")
+		_, err := io.Copy(w, f)
+		return err
 	}
 
-	// Download the audio
-	dl := exec.CommandContext(ctx,
-		"yt-dlp", "-q", "-v", "-f", "ba[vcodec=none]",
-		"--proxy", os.Getenv("PROXY"), // If undefined this simply performs a direct connection
-		"--compat-options", "no-youtube-unavailable-videos",
-		"-o", "-", url,
-	)
-	audio, err := dl.Output()
+	s, err := c.Stream(ctx, t.URL)
 	if err != nil {
-		return nil, err
+		return err
 	}
+	defer s.Close()
 
-	// Encode the audio into opus
-	encode := exec.CommandContext(ctx,
-		"ffmpeg", "-i", "-",
-		"-hide_banner", "-loglevel", "error", "-vn",
-		"-c:a", "libopus", "-b:a", "96k", "-vbr", "off", "-application", "audio",
-		"-f", "opus", "-",
-	)
-	encode.Stdin = bytes.NewReader(audio)
-	encAudio, err := encode.Output()
+	// Failing to cache the track shouldn't stop it from playing
+	cw, err := c.cache.Create(key)
 	if err != nil {
-		return nil, err
+		log.Error().Err(err).Str("key", key).Msg("failed to cache track")
+		_, err = io.Copy(w, s)
+		return err
+	}
+	tee := &cacheTee{s: s, cw: cw, key: key}
+	_, err = io.Copy(w, tee)
+	if err != nil || tee.err != nil {
+		cw.Abort()
+		return err
 	}
-	return encAudio, nil
+	if err := cw.Commit(); err != nil {
+		log.Error().Err(err).Str("key", key).Msg("failed to cache track")
+	}
+	return nil
 }
 
 func (c *Client) ytdlpMetadata(ctx context.Context, query string, unflatten bool, extraArgs ...string) ([]byte, error) {
@@ -130,25 +251,30 @@ func (c *Client) ytdlpMetadata(ctx context.Context, query string, unflatten bool
 
 	args := []string{
 		"-J", "-i", "-f", "ba[vcodec=none]",
-		"--proxy", os.Getenv("PROXY"), // If undefined this simply performs a direct connection
 		"--no-playlist", "--no-warnings",
 		"--compat-options", "no-youtube-unavailable-videos",
-		"--flat-playlist",
-	}
-	if strings.Contains(query, "soundcloud.com") || unflatten {
-		// For soundcloud we need to remove --flat-playlist otherwise
-		// we don't get the full playlist data
-		args = args[:len(args)-1]
 	}
-	for _, eArg := range extraArgs {
-		args = append(args, eArg)
+	// For soundcloud we can't use --flat-playlist
+	// otherwise we don't get the full playlist data
+	if !strings.Contains(query, "soundcloud.com") && !unflatten {
+		args = append(args, "--flat-playlist")
 	}
-	args = append(args, query)
+	args = append(args, extraArgs...)
+	args = append(c.ytdlpArgs(args), query)
 
-	dl := exec.CommandContext(ctx, "yt-dlp", args...)
+	dl := c.cfg.Executor.Command(ctx, c.cfg.YtdlpPath, args...)
 	buf, err := dl.Output()
 	if err != nil {
 		return nil, err
 	}
 	return buf, nil
 }
+
+// ytdlpArgs adds the proxy and the extra args from the config to the args
+func (c *Client) ytdlpArgs(args []string) []string {
+	// Without a proxy yt-dlp connects directly
+	if c.cfg.Proxy != "" {
+		args = append(args, "--proxy", c.cfg.Proxy)
+	}
+	return append(args, c.cfg.YtdlpArgs...)
+}
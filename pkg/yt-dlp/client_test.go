@@ -1,8 +1,16 @@
 package ytdlp
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 )
 
@@ -11,83 +19,312 @@ const (
 	soundcloud         = "https://soundcloud.com/fractalfantasy/sinjin-hawke-blank-spaces-1"
 	youtubePlaylist    = "https://www.youtube.com/playlist?list=PLwVziAzt2oDLTvZtj6O0mnagwpdZfhROW"
 	soundcloudPlaylist = "https://soundcloud.com/zora-jones/sets/vicious-circles-sinjin-hawke-zora-jones"
+	invalidPlaylist    = "https://www.youtube.com/playlist?list=PLkLKCs4iHkejj-QVr2q_WLjOUueG3x5Es"
 )
 
-var c = NewClient(os.Getenv("SPOTIFY_ID"), os.Getenv("SPOTIFY_SECRET"))
+// ytdlpFixtures are the recorded output of yt-dlp -J for each query
+var ytdlpFixtures = map[string]string{
+	youtube:            "youtube.json",
+	soundcloud:         "soundcloud.json",
+	youtubePlaylist:    "youtube_playlist.json",
+	soundcloudPlaylist: "soundcloud_playlist.json",
+	invalidPlaylist:    "unavailable_playlist.json",
+	"https://www.youtube.com/watch?v=LYzM3oWC8p8": "youtube_watch.json",
+	"ytsearch1:and you were one":                  "search.json",
+	"ytsearch5: Sinjin Hawke Onset":               "spotify_search.json",
+	"ytsearch3:sinjin hawke onset":                "spotify_search.json",
+	"ytsearch5: Someone Onset":                    "spotify_search.json",
+	"ytsearch5: Zora Jones And You Were One":      "search.json",
+	"ytsearch5:sinjin hawke onset":                "spotify_search.json",
+}
+
 var ctx = context.TODO()
 
-func TestLink(t *testing.T) {
-	track, err := c.searchLink(ctx, youtube)
-	if err != nil {
-		t.Error(err)
-	} else {
-		t.Log("Youtube:", track)
+// fakeExecutor runs this test binary in place of yt-dlp, ffmpeg and
+// ffprobe, see TestHelperProcess for how each of them is faked
+type fakeExecutor struct {
+	calls atomic.Int64
+}
+
+func (e *fakeExecutor) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	e.calls.Add(1)
+	args = append([]string{"-test.run=TestHelperProcess", "--", name}, args...)
+	cmd := exec.CommandContext(ctx, os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "SURF_HELPER_PROCESS=1")
+	return cmd
+}
+
+func newTestClient() (*Client, *fakeExecutor) {
+	e := &fakeExecutor{}
+	return NewClient(ClientConfig{Executor: e}), e
+}
+
+// TestHelperProcess isn't a real test, it's run by the fakeExecutor
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("SURF_HELPER_PROCESS") != "1" {
+		return
+	}
+	args := os.Args
+	for len(args) > 0 && args[0] != "--" {
+		args = args[1:]
 	}
+	name, args := args[1], args[2:]
 
-	track, err = c.searchLink(ctx, soundcloud)
+	var err error
+	switch name {
+	case "yt-dlp":
+		err = fakeYtdlp(args)
+	case "ffmpeg":
+		err = fakeFFmpeg(args)
+	case "ffprobe":
+		err = printFixture("ffprobe.json")
+	default:
+		err = fmt.Errorf("unknown command: %s", name)
+	}
 	if err != nil {
-		t.Error(err)
-	} else {
-		t.Log("Soundcloud:", track)
+		fmt.Fprintln(os.Stderr, "ERROR:", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// fakeYtdlp prints the fixture for the query if it's asked for
+// metadata, otherwise it "downloads" the url by printing it
+func fakeYtdlp(args []string) error {
+	query := args[len(args)-1]
+	for _, arg := range args {
+		if arg == "-J" {
+			f, ok := ytdlpFixtures[query]
+			if !ok {
+				return fmt.Errorf("unsupported url: %s", query)
+			}
+			return printFixture(f)
+		}
+	}
+	switch query {
+	case "https://www.youtube.com/watch?v=broken":
+		return errors.New("video unavailable")
+	case "https://www.youtube.com/watch?v=ratelimited":
+		return errors.New("unable to download video data: HTTP Error 429: Too Many Requests")
 	}
+	_, err := fmt.Print("audio:" + query)
+	return err
+}
 
-	track, err = c.searchLink(ctx, youtubePlaylist)
+// fakeFFmpeg "encodes" its input by prefixing it
+func fakeFFmpeg(args []string) error {
+	var src io.Reader = os.Stdin
+	if input := args[1]; input != "-" {
+		f, err := os.Open(strings.TrimPrefix(input, "file:"))
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		src = f
+	}
+	// Nothing is output until there's something to encode
+	data, err := io.ReadAll(src)
 	if err != nil {
-		t.Error(err)
-	} else {
-		t.Log("Youtube Playlist:", track)
+		return err
 	}
+	if len(data) == 0 {
+		return errors.New("invalid data found when processing input")
+	}
+	_, err = fmt.Print("opus:" + string(data))
+	return err
+}
 
-	track, err = c.searchLink(ctx, soundcloudPlaylist)
+func printFixture(name string) error {
+	data, err := os.ReadFile(filepath.Join("testdata", name))
 	if err != nil {
-		t.Error(err)
-	} else {
-		t.Log("Soundcloud Playlist:", track)
+		return err
+	}
+	_, err = os.Stdout.Write(data)
+	return err
+}
+
+func TestLink(t *testing.T) {
+	c, _ := newTestClient()
+	tests := []struct {
+		url    string
+		tracks int
+		title  string
+	}{
+		{youtube, 1, "Sinjin Hawke - Onset"},
+		{soundcloud, 1, "Sinjin Hawke - Blank Spaces"},
+		{youtubePlaylist, 2, "Sinjin Hawke - Onset"},
+		{soundcloudPlaylist, 1, "Vicious Circles"},
+	}
+	for _, tc := range tests {
+		tracks, err := c.searchLink(ctx, tc.url)
+		if err != nil {
+			t.Errorf("%s: %v", tc.url, err)
+			continue
+		}
+		if len(tracks) != tc.tracks || tracks[0].VideoTitle != tc.title {
+			t.Errorf("%s: invalid tracks: %v", tc.url, tracks)
+		}
+	}
+
+	// Flat playlists still identify their tracks
+	tracks, _ := c.searchLink(ctx, youtubePlaylist)
+	if len(tracks) > 0 && tracks[0].cacheKey() != "youtube-dceGIpBtQZo" {
+		t.Errorf("invalid cache key: %q", tracks[0].cacheKey())
 	}
 }
 
 func TestSearch(t *testing.T) {
-	tracks, err := c.searchQuery(ctx, "and you were one")
+	c, _ := newTestClient()
+	track, err := c.searchQuery(ctx, "and you were one")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if track.ID != "LYzM3oWC8p8" || track.URL != "https://www.youtube.com/watch?v=LYzM3oWC8p8" {
+		t.Errorf("invalid track: %+v", track)
+	}
+}
+
+func TestSearchResults(t *testing.T) {
+	c, _ := newTestClient()
+	tracks, err := c.Search(ctx, "sinjin hawke onset", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 3 || tracks[2].ID != "dceGIpBtQZo" || tracks[1].Uploader != "Fractal Fantasy" {
+		t.Errorf("invalid results: %v", tracks)
 	}
-	t.Log("Search:", tracks)
 }
 
 func TestDownload(t *testing.T) {
+	c, _ := newTestClient()
 	tracks, err := c.DownloadMetadata(ctx, "and you were one")
 	if err != nil {
 		t.Error(err)
+	} else if len(tracks) != 1 || tracks[0].ID != "LYzM3oWC8p8" {
+		t.Errorf("invalid search: %v", tracks)
 	}
-	t.Log("Download (search):", tracks)
 
 	tracks, err = c.DownloadMetadata(ctx, "https://www.youtube.com/watch?v=LYzM3oWC8p8")
 	if err != nil {
 		t.Error(err)
+	} else if len(tracks) != 1 || tracks[0].Duration.Seconds() != 198 {
+		t.Errorf("invalid link: %v", tracks)
+	}
+}
+
+func TestInvalidTracks(t *testing.T) {
+	c, _ := newTestClient()
+	_, err := c.DownloadMetadata(ctx, invalidPlaylist)
+	if err == nil {
+		t.Error("expected an error for a playlist without tracks")
+	}
+	_, err = c.DownloadMetadata(ctx, "https://www.youtube.com/watch?v=unknown")
+	if err == nil {
+		t.Error("expected an error when yt-dlp fails")
 	}
-	t.Log("Download (link):", tracks)
 }
 
-func TestSpotifySearch(t *testing.T) {
-	track, err := c.DownloadMetadata(ctx, "https://open.spotify.com/track/3Pb9QabepyR9e9D8NqorPH?si=4f75dad081f4430b")
+func TestDownloadTrack(t *testing.T) {
+	c, e := newTestClient()
+	cache, err := NewCache(t.TempDir(), 1024)
 	if err != nil {
-		t.Error(err)
-	} else {
-		t.Log("Track (spotify):", track)
+		t.Fatal(err)
 	}
+	c.cache = cache
 
-	track, err = c.DownloadMetadata(ctx, "https://open.spotify.com/album/0QMxX4ZCFZK3ku24sviec4?si=gYf5pWPZSm27FbzCJNzr6g")
+	track := &Track{ID: "dceGIpBtQZo", Extractor: "Youtube", URL: youtube}
+	want := "opus:audio:" + youtube
+	for i := 0; i < 2; i++ {
+		var buf bytes.Buffer
+		if err := c.DownloadTrack(ctx, track, &buf); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("invalid track: %q", buf.String())
+		}
+	}
+	// The second download should have come from the cache
+	if calls := e.calls.Load(); calls != 2 {
+		t.Errorf("expected yt-dlp and ffmpeg to run once but ran %d commands", calls)
+	}
+
+	// Failed downloads report yt-dlp's error and aren't cached
+	broken := &Track{ID: "broken", Extractor: "Youtube", URL: "https://www.youtube.com/watch?v=broken"}
+	err = c.DownloadTrack(ctx, broken, io.Discard)
+	var procErr *ProcessError
+	if !errors.As(err, &procErr) || !strings.Contains(procErr.Stderr, "video unavailable") {
+		t.Errorf("expected yt-dlp's error but got: %v", err)
+	}
+	if _, ok := cache.Open(broken.cacheKey()); ok {
+		t.Error("failed download was cached")
+	}
+}
+
+func TestDownloadFile(t *testing.T) {
+	c, _ := newTestClient()
+	path := filepath.Join(t.TempDir(), "onset.flac")
+	if err := os.WriteFile(path, []byte("flac"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.DownloadTrack(ctx, &Track{file: path}, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "opus:flac" {
+		t.Errorf("invalid track: %q", buf.String())
+	}
+
+	e, err := ffprobe(ctx, c.cfg.Executor, c.cfg.FFprobePath, path)
 	if err != nil {
-		t.Error(err)
-	} else {
-		t.Log("Album (spotify):", track)
+		t.Fatal(err)
 	}
+	if e.Title != "Onset" || e.Number != 1 || e.Disc != 1 {
+		t.Errorf("invalid tags: %+v", e)
+	}
+}
 
+// recordingExecutor records the args the commands are run with
+type recordingExecutor struct {
+	args [][]string
 }
 
-func TestInvalidTracks(t *testing.T) {
-	_, err := c.DownloadMetadata(ctx, "https://www.youtube.com/playlist?list=PLkLKCs4iHkejj-QVr2q_WLjOUueG3x5Es")
-	if err == nil {
-		t.Error(err)
+func (e *recordingExecutor) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	e.args = append(e.args, append([]string{name}, args...))
+	return exec.CommandContext(ctx, "true")
+}
+
+func TestClientConfig(t *testing.T) {
+	e := &recordingExecutor{}
+	c := NewClient(ClientConfig{
+		YtdlpPath:  "/opt/yt-dlp",
+		FFmpegPath: "/opt/ffmpeg",
+		YtdlpArgs:  []string{"--cookies", "cookies.txt"},
+		FFmpegArgs: []string{"-af", "loudnorm"},
+		Proxy:      "socks5://127.0.0.1:1080",
+		Executor:   e,
+	})
+
+	c.ytdlpMetadata(ctx, youtube, false)
+	s, err := c.Stream(ctx, youtube)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, s)
+	s.Close()
+
+	if len(e.args) != 3 {
+		t.Fatalf("expected 3 commands but got %d", len(e.args))
+	}
+	for i, want := range []string{
+		"/opt/yt-dlp -J .* --proxy socks5://127.0.0.1:1080 --cookies cookies.txt " + youtube,
+		"/opt/yt-dlp .* --proxy socks5://127.0.0.1:1080 --cookies cookies.txt " + youtube,
+		"/opt/ffmpeg -i - .* -af loudnorm -f opus -",
+	} {
+		got := strings.Join(e.args[i], " ")
+		prefix, suffix, _ := strings.Cut(want, " .* ")
+		if !strings.HasPrefix(got, prefix) || !strings.HasSuffix(got, suffix) {
+			t.Errorf("expected %q but got %q", want, got)
+		}
 	}
 }
@@ -0,0 +1,140 @@
+package ytdlp
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+	"github.com/zmb3/spotify/v2"
+)
+
+// ClientConfig configures the client, the zero value
+// finds yt-dlp, ffmpeg and ffprobe on the $PATH
+type ClientConfig struct {
+	// SpotifyID and SpotifySecret are needed to play spotify links
+	SpotifyID, SpotifySecret string
+	// SpotifyURL and SpotifyTokenURL replace the spotify api,
+	// they're empty to use the real one
+	SpotifyURL, SpotifyTokenURL string
+	// SpotifyMarket is the country code whose artist top tracks
+	// and podcasts are played, it defaults to the US
+	SpotifyMarket string
+
+	// Paths of the binaries the client runs
+	YtdlpPath, FFmpegPath, FFprobePath string
+	// Extra arguments given to yt-dlp and ffmpeg, they're added
+	// before the url for yt-dlp and before the output for ffmpeg
+	YtdlpArgs, FFmpegArgs []string
+	// Proxy is the HTTP/HTTPS/SOCKS5 proxy every download uses
+	Proxy string
+	// AllowPrivateHosts lets links to the loopback, private and link-local
+	// addresses be played, e.g. radio on the LAN. They're refused by
+	// default so users can't make the bot request its own network
+	AllowPrivateHosts bool
+	// Executor runs the binaries, it defaults to os/exec
+	Executor Executor
+
+	// CacheDir is where downloaded tracks are cached, they
+	// aren't cached if it's empty. CacheSize is in MB
+	CacheDir  string
+	CacheSize int64
+	// MatchCache is where the videos which spotify tracks were matched
+	// to are saved, it defaults to a file in the CacheDir. Tracks are
+	// searched for again once their match is older than MatchTTL
+	MatchCache string
+	MatchTTL   time.Duration
+	// MatchAdmins are the ids of the discord users who can override
+	// matches, they're used by every server so nobody can if it's empty
+	MatchAdmins []string
+	// LibraryDir is the local music to index, the index is saved
+	// to LibraryIndex which defaults to a file in the LibraryDir
+	LibraryDir, LibraryIndex string
+}
+
+// ConfigFromEnv reads the config from the environment variables
+func ConfigFromEnv() ClientConfig {
+	cfg := ClientConfig{
+		SpotifyID:     os.Getenv("SPOTIFY_ID"),
+		SpotifySecret: os.Getenv("SPOTIFY_SECRET"),
+		SpotifyMarket: os.Getenv("SPOTIFY_MARKET"),
+		YtdlpPath:     os.Getenv("YTDLP_PATH"),
+		FFmpegPath:    os.Getenv("FFMPEG_PATH"),
+		FFprobePath:   os.Getenv("FFPROBE_PATH"),
+		YtdlpArgs:     strings.Fields(os.Getenv("YTDLP_ARGS")),
+		FFmpegArgs:    strings.Fields(os.Getenv("FFMPEG_ARGS")),
+		Proxy:         os.Getenv("PROXY"),
+		CacheDir:      os.Getenv("CACHE_DIR"),
+		MatchCache:    os.Getenv("MATCH_CACHE"),
+		LibraryDir:    os.Getenv("LIBRARY_DIR"),
+		LibraryIndex:  os.Getenv("LIBRARY_INDEX"),
+	}
+	cfg.AllowPrivateHosts, _ = strconv.ParseBool(os.Getenv("ALLOW_PRIVATE_HOSTS"))
+	cfg.MatchAdmins = strings.FieldsFunc(os.Getenv("MATCH_ADMINS"), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	if s := os.Getenv("CACHE_SIZE"); s != "" {
+		size, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			log.Error().Err(err).Str("size", s).Msg("invalid $CACHE_SIZE given")
+		} else {
+			cfg.CacheSize = size
+		}
+	}
+	if s := os.Getenv("MATCH_TTL"); s != "" {
+		days, err := strconv.Atoi(s)
+		if err != nil {
+			log.Error().Err(err).Str("ttl", s).Msg("invalid $MATCH_TTL given")
+		} else {
+			cfg.MatchTTL = time.Duration(days) * 24 * time.Hour
+		}
+	}
+	return cfg
+}
+
+// withDefaults fills in the fields which weren't set
+func (cfg ClientConfig) withDefaults() ClientConfig {
+	if cfg.SpotifyMarket == "" {
+		cfg.SpotifyMarket = spotify.CountryUSA
+	}
+	if cfg.YtdlpPath == "" {
+		cfg.YtdlpPath = "yt-dlp"
+	}
+	if cfg.FFmpegPath == "" {
+		cfg.FFmpegPath = "ffmpeg"
+	}
+	if cfg.FFprobePath == "" {
+		cfg.FFprobePath = "ffprobe"
+	}
+	if cfg.Executor == nil {
+		cfg.Executor = ExecExecutor{}
+	}
+	if cfg.CacheSize <= 0 {
+		cfg.CacheSize = DefaultCacheSize
+	}
+	if cfg.MatchCache == "" && cfg.CacheDir != "" {
+		cfg.MatchCache = filepath.Join(cfg.CacheDir, matchesName)
+	}
+	if cfg.MatchTTL <= 0 {
+		cfg.MatchTTL = DefaultMatchTTL
+	}
+	return cfg
+}
+
+// Executor creates the commands the client runs, tests use it to replace
+// the binaries with fakes. The commands must be killed once the ctx is done
+type Executor interface {
+	Command(ctx context.Context, name string, args ...string) *exec.Cmd
+}
+
+// ExecExecutor runs the binaries with os/exec
+type ExecExecutor struct{}
+
+func (ExecExecutor) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, args...)
+}
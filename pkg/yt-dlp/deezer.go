@@ -0,0 +1,148 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deezerAPI is deezer's public api, it doesn't need a token
+const deezerAPI = "https://api.deezer.com/"
+
+// deezerResolver looks up deezer links with its api and
+// then searches for the tracks on youtube
+type deezerResolver struct{}
+
+func (deezerResolver) Name() string {
+	return "deezer"
+}
+
+func (deezerResolver) Match(u *url.URL) bool {
+	switch hostname(u) {
+	case "deezer.com", "www.deezer.com", "link.deezer.com", "deezer.page.link":
+		return true
+	}
+	return false
+}
+
+func (r deezerResolver) Resolve(ctx context.Context, c *Client, u *url.URL) ([]*Track, error) {
+	return resolveInfos(ctx, c, r, u)
+}
+
+func (deezerResolver) infos(ctx context.Context, c *Client, u *url.URL) ([]trackInfo, error) {
+	// Links shared from the app are short links to the real one
+	if host := hostname(u); host == "link.deezer.com" || host == "deezer.page.link" {
+		var err error
+		u, err = c.expandLink(ctx, u)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	kind, id, err := parseDeezerLink(u)
+	if err != nil {
+		return nil, err
+	}
+	return c.deezerInfos(ctx, kind, id)
+}
+
+// parseDeezerLink returns the type and id of what the link points to,
+// links may be localised e.g. deezer.com/en/track/id
+func parseDeezerLink(u *url.URL) (string, string, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case "track", "album", "playlist":
+			if _, err := strconv.ParseUint(parts[i+1], 10, 64); err == nil {
+				return parts[i], parts[i+1], nil
+			}
+		}
+	}
+	return "", "", errors.New("invalid deezer link type")
+}
+
+type deezerTrack struct {
+	Title    string `json:"title"`
+	Duration int    `json:"duration"`
+	Artist   struct {
+		Name string `json:"name"`
+	} `json:"artist"`
+	// Contributors are every artist but they're only given for single tracks
+	Contributors []struct {
+		Name string `json:"name"`
+	} `json:"contributors"`
+}
+
+func (t deezerTrack) info() trackInfo {
+	var artists []string
+	for _, c := range t.Contributors {
+		artists = append(artists, c.Name)
+	}
+	if len(artists) == 0 && t.Artist.Name != "" {
+		artists = append(artists, t.Artist.Name)
+	}
+	return trackInfo{
+		Artists:  artists,
+		Title:    t.Title,
+		Duration: time.Duration(t.Duration) * time.Second,
+	}
+}
+
+// deezerError is returned with an ok status instead of the response
+type deezerError struct {
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (e deezerError) err() error {
+	if e.Error == nil {
+		return nil
+	}
+	return errors.New("deezer: " + e.Error.Message)
+}
+
+func (c *Client) deezerInfos(ctx context.Context, kind, id string) ([]trackInfo, error) {
+	if kind == "track" {
+		var t struct {
+			deezerTrack
+			deezerError
+		}
+		if err := c.getJSON(ctx, deezerAPI+"track/"+id, &t); err != nil {
+			return nil, err
+		}
+		if err := t.err(); err != nil {
+			return nil, err
+		}
+		return []trackInfo{t.info()}, nil
+	}
+
+	// Albums and playlists are split into pages
+	infos := make([]trackInfo, 0)
+	next := deezerAPI + kind + "/" + id + "/tracks"
+	for next != "" {
+		var page struct {
+			Data []deezerTrack `json:"data"`
+			Next string        `json:"next"`
+			deezerError
+		}
+		if err := c.getJSON(ctx, next, &page); err != nil {
+			return nil, err
+		}
+		if err := page.err(); err != nil {
+			return nil, err
+		}
+		for _, t := range page.Data {
+			infos = append(infos, t.info())
+		}
+		next = page.Next
+	}
+	if len(infos) == 0 {
+		return nil, errors.New("deezer: no tracks found")
+	}
+	return infos, nil
+}
@@ -0,0 +1,265 @@
+package ytdlp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxPlaylistSize is the largest m3u/pls playlist we'll read
+	maxPlaylistSize = 1024 * 1024
+	// maxPlaylistProbes is how many of a playlist's entries are
+	// requested to find one which plays, they're usually mirrors
+	// of the same stream so the rest aren't needed
+	maxPlaylistProbes = 5
+)
+
+// audioExts are the extensions of audio files we can play directly
+var audioExts = map[string]bool{
+	".mp3":  true,
+	".ogg":  true,
+	".oga":  true,
+	".opus": true,
+	".flac": true,
+	".m4a":  true,
+	".aac":  true,
+	".wav":  true,
+}
+
+// directResolver handles links to audio files, m3u/pls
+// playlists and live Icecast/Shoutcast streams
+type directResolver struct{}
+
+func (directResolver) Name() string {
+	return "direct"
+}
+
+func (directResolver) Match(u *url.URL) bool {
+	return u.Scheme == "http" || u.Scheme == "https"
+}
+
+func (directResolver) Resolve(ctx context.Context, c *Client, u *url.URL) ([]*Track, error) {
+	resp, err := c.get(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch kind := directKind(u, resp); kind {
+	case kindM3U, kindPLS:
+		entries, err := parsePlaylist(kind, u, io.LimitReader(resp.Body, maxPlaylistSize))
+		if err != nil {
+			return nil, err
+		}
+		// The first entry which can be played is used
+		if len(entries) > maxPlaylistProbes {
+			entries = entries[:maxPlaylistProbes]
+		}
+		for _, e := range entries {
+			t, err := c.probe(ctx, e)
+			if err != nil {
+				log.Error().Err(err).Str("url", e.url.String()).Msg("failed to probe playlist entry")
+				continue
+			}
+			return []*Track{t}, nil
+		}
+		return nil, errors.New("no tracks found")
+	case kindAudio, kindLive:
+		return []*Track{directTrack(playlistEntry{url: u}, kind, resp)}, nil
+	default:
+		ct := resp.Header.Get("Content-Type")
+		return nil, fmt.Errorf("%w: unsupported content type %q", ErrNoResolver, ct)
+	}
+}
+
+// probe requests the playlist entry to find out what it is
+func (c *Client) probe(ctx context.Context, e playlistEntry) (*Track, error) {
+	resp, err := c.get(ctx, e.url.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	kind := directKind(e.url, resp)
+	if kind != kindAudio && kind != kindLive {
+		return nil, fmt.Errorf("unsupported playlist entry: %q", resp.Header.Get("Content-Type"))
+	}
+	return directTrack(e, kind, resp), nil
+}
+
+// get requests the url, asking for ICY metadata in case it's a live stream
+func (c *Client) get(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Icy-MetaData", "1")
+	return c.do(req)
+}
+
+// directTrack creates the track for the response
+func directTrack(e playlistEntry, kind contentKind, resp *http.Response) *Track {
+	t := &Track{
+		URL:        e.url.String(),
+		VideoTitle: e.title,
+		Uploader:   e.url.Hostname(),
+		Duration:   e.duration,
+		Live:       kind == kindLive,
+		direct:     true,
+	}
+	if name := resp.Header.Get("icy-name"); name != "" {
+		t.Uploader = name
+	}
+	if t.VideoTitle == "" {
+		t.VideoTitle = path.Base(e.url.Path)
+		if t.VideoTitle == "/" || t.VideoTitle == "." {
+			t.VideoTitle = e.url.Hostname()
+		}
+	}
+	if t.Live {
+		t.Duration = 0
+	}
+	return t
+}
+
+// contentKind is what a direct link points to
+type contentKind int
+
+const (
+	kindUnknown contentKind = iota
+	kindAudio
+	kindLive
+	kindM3U
+	kindPLS
+)
+
+// directKind works out what the response is from its
+// headers, falling back to the extension of the url
+func directKind(u *url.URL, resp *http.Response) contentKind {
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	ext := strings.ToLower(path.Ext(u.Path))
+
+	switch {
+	case ct == "audio/x-mpegurl" || ct == "audio/mpegurl" || ext == ".m3u":
+		return kindM3U
+	case ct == "audio/x-scpls" || ext == ".pls":
+		return kindPLS
+	case resp.Header.Get("icy-metaint") != "" || resp.Header.Get("icy-name") != "":
+		return kindLive
+	case strings.HasPrefix(ct, "audio/") || ct == "application/ogg":
+		// Live streams never end so they don't have a length
+		if resp.ContentLength < 0 && !audioExts[ext] {
+			return kindLive
+		}
+		return kindAudio
+	case audioExts[ext] && (ct == "" || ct == "application/octet-stream"):
+		return kindAudio
+	default:
+		return kindUnknown
+	}
+}
+
+// playlistEntry is a url found in an m3u/pls playlist
+type playlistEntry struct {
+	url      *url.URL
+	title    string
+	duration time.Duration
+}
+
+// parsePlaylist reads the entries of the m3u/pls playlist, relative
+// urls are resolved against the url of the playlist
+func parsePlaylist(kind contentKind, base *url.URL, r io.Reader) ([]playlistEntry, error) {
+	var entries []playlistEntry
+	add := func(link, title string, secs int) {
+		u, err := base.Parse(strings.TrimSpace(link))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		e := playlistEntry{url: u, title: strings.TrimSpace(title)}
+		if secs > 0 {
+			e.duration = time.Duration(secs) * time.Second
+		}
+		entries = append(entries, e)
+	}
+
+	sc := bufio.NewScanner(r)
+	switch kind {
+	case kindM3U:
+		// #EXTINF lines describe the url on the next line
+		var title string
+		var secs int
+		for sc.Scan() {
+			line := strings.TrimSpace(sc.Text())
+			switch {
+			case strings.HasPrefix(line, "#EXTINF:"):
+				info, name, _ := strings.Cut(strings.TrimPrefix(line, "#EXTINF:"), ",")
+				secs = 0
+				if fields := strings.Fields(info); len(fields) > 0 {
+					secs, _ = strconv.Atoi(fields[0])
+				}
+				title = name
+			case line == "" || strings.HasPrefix(line, "#"):
+			default:
+				add(line, title, secs)
+				title, secs = "", 0
+			}
+		}
+	case kindPLS:
+		// Entries are numbered, e.g. File1, Title1 and Length1
+		files := make(map[int]string)
+		titles := make(map[int]string)
+		lengths := make(map[int]int)
+		var order []int
+		for sc.Scan() {
+			key, value, ok := strings.Cut(strings.TrimSpace(sc.Text()), "=")
+			if !ok {
+				continue
+			}
+			key = strings.ToLower(key)
+			for _, field := range []string{"file", "title", "length"} {
+				if !strings.HasPrefix(key, field) {
+					continue
+				}
+				i, err := strconv.Atoi(key[len(field):])
+				if err != nil {
+					continue
+				}
+				switch field {
+				case "file":
+					if _, ok := files[i]; !ok {
+						order = append(order, i)
+					}
+					files[i] = value
+				case "title":
+					titles[i] = value
+				case "length":
+					lengths[i], _ = strconv.Atoi(value)
+				}
+			}
+		}
+		for _, i := range order {
+			add(files[i], titles[i], lengths[i])
+		}
+	default:
+		return nil, errors.New("not a playlist")
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("playlist is empty")
+	}
+	return entries, nil
+}
@@ -0,0 +1,184 @@
+package ytdlp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newDirectServer(t *testing.T) (*httptest.Server, *Client) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/song.mp3", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("Content-Length", "4")
+		w.Write([]byte("song"))
+	})
+	mux.HandleFunc("/radio", func(w http.ResponseWriter, r *http.Request) {
+		// Live streams send audio until the client goes away
+		w.Header().Set("Content-Type", "audio/mpeg")
+		w.Header().Set("icy-name", "Surf FM")
+		w.Header().Set("icy-metaint", "4")
+		w.Write([]byte("live"))
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	mux.HandleFunc("/list.m3u", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/x-mpegurl")
+		fmt.Fprint(w, "#EXTM3U\nmissing.mp3\n#EXTINF:123,Artist - Song\nsong.mp3\n\n#EXTINF:-1,Surf FM\n/radio\n")
+	})
+	mux.HandleFunc("/missing.m3u", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/x-mpegurl")
+		fmt.Fprint(w, strings.Repeat("missing.mp3\n", maxPlaylistProbes)+"song.mp3\n")
+	})
+	mux.HandleFunc("/list.pls", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "audio/x-scpls")
+		fmt.Fprint(w, "[playlist]\nFile1=/radio\nTitle1=Surf FM\nLength1=-1\nNumberOfEntries=1\nVersion=2\n")
+	})
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html></html>")
+	})
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	c := &Client{resolvers: defaultResolvers(), fallback: directResolver{}, http: srv.Client()}
+	return srv, c
+}
+
+func TestDirectResolve(t *testing.T) {
+	srv, c := newDirectServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tracks, err := c.DownloadMetadata(ctx, srv.URL+"/song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].Live || !tracks[0].direct || tracks[0].VideoTitle != "song.mp3" {
+		t.Errorf("invalid audio file track: %+v", tracks[0])
+	}
+
+	tracks, err = c.DownloadMetadata(ctx, srv.URL+"/radio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || !tracks[0].Live || tracks[0].Uploader != "Surf FM" {
+		t.Errorf("invalid live track: %+v", tracks[0])
+	}
+
+	// Entries which can't be played are skipped until one can
+	tracks, err = c.DownloadMetadata(ctx, srv.URL+"/list.m3u")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 {
+		t.Fatalf("expected 1 track but got %d", len(tracks))
+	}
+	if tracks[0].VideoTitle != "Artist - Song" || tracks[0].Duration != 123*time.Second || tracks[0].Live {
+		t.Errorf("invalid m3u track: %+v", tracks[0])
+	}
+
+	// Only the first few entries are tried
+	if _, err := c.DownloadMetadata(ctx, srv.URL+"/missing.m3u"); err == nil {
+		t.Error("expected entries after the first few to not be tried")
+	}
+
+	tracks, err = c.DownloadMetadata(ctx, srv.URL+"/list.pls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].VideoTitle != "Surf FM" || !tracks[0].Live {
+		t.Errorf("invalid pls tracks: %+v", tracks)
+	}
+
+	_, err = c.DownloadMetadata(ctx, srv.URL+"/page")
+	if !errors.Is(err, ErrNoResolver) {
+		t.Errorf("expected no resolver for a web page but got: %v", err)
+	}
+}
+
+func TestDirectPrivateHost(t *testing.T) {
+	srv, _ := newDirectServer(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The test server is on the loopback address
+	_, err := NewClient(ClientConfig{}).DownloadMetadata(ctx, srv.URL+"/song.mp3")
+	if !errors.Is(err, ErrPrivateHost) {
+		t.Errorf("expected private hosts to be refused but got: %v", err)
+	}
+	tracks, err := NewClient(ClientConfig{AllowPrivateHosts: true}).DownloadMetadata(ctx, srv.URL+"/song.mp3")
+	if err != nil || len(tracks) != 1 {
+		t.Errorf("expected private hosts to be allowed but got %v: %v", tracks, err)
+	}
+
+	for _, ip := range []string{"127.0.0.1", "10.0.0.1", "192.168.1.1", "169.254.169.254", "::1", "fe80::1", "0.0.0.0"} {
+		if !isPrivateIP(net.ParseIP(ip)) {
+			t.Errorf("expected %s to be private", ip)
+		}
+	}
+	if isPrivateIP(net.ParseIP("1.1.1.1")) {
+		t.Error("expected 1.1.1.1 to be public")
+	}
+}
+
+func TestICYReader(t *testing.T) {
+	meta := func(s string) []byte {
+		b := []byte(s)
+		b = append(b, make([]byte, 16-len(b)%16)...)
+		return append([]byte{byte(len(b) / 16)}, b...)
+	}
+	var src bytes.Buffer
+	src.WriteString("abcd")
+	src.Write(meta("StreamTitle='It's A - B';StreamUrl='';"))
+	src.WriteString("efgh")
+	src.WriteByte(0)
+	src.WriteString("ij")
+
+	var titles []string
+	r := newICYReader(&src, 4, func(title string) { titles = append(titles, title) })
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "abcdefghij" {
+		t.Errorf("metadata wasn't stripped: %q", data)
+	}
+	if len(titles) != 1 || titles[0] != "It's A - B" {
+		t.Errorf("invalid titles: %q", titles)
+	}
+
+	// Truncated metadata is an error
+	r = newICYReader(strings.NewReader("abcd\x01Stream"), 4, func(string) {})
+	if _, err := io.ReadAll(r); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF but got: %v", err)
+	}
+}
+
+func TestStreamTitle(t *testing.T) {
+	track := &Track{titles: make(chan string, 1)}
+	track.setStreamTitle("a")
+	track.setStreamTitle("b")
+	track.setStreamTitle("b")
+
+	// Only the latest title is kept
+	if title := <-track.Titles(); title != "b" {
+		t.Errorf("expected the latest title but got %q", title)
+	}
+	select {
+	case title := <-track.Titles():
+		t.Errorf("unchanged title was sent: %q", title)
+	default:
+	}
+	if track.StreamTitle() != "b" {
+		t.Errorf("invalid stream title: %q", track.StreamTitle())
+	}
+}
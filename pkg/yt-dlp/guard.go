@@ -0,0 +1,83 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateHost is returned if a link is to a private address
+// and the client wasn't configured to allow them
+var ErrPrivateHost = errors.New("links to private addresses aren't allowed")
+
+// isPrivateIP returns whether the ip can't be reached from the internet,
+// e.g. loopback, LAN and link-local addresses such as 169.254.169.254
+func isPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// publicDialer dials like the default transport but refuses to connect to
+// private addresses, the check happens once the host's been resolved so
+// redirects and dns records which point to them are refused too. The
+// exempt address, i.e. the proxy's, can always be connected to
+func publicDialer(exempt string) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	public := &net.Dialer{
+		Timeout:   dialer.Timeout,
+		KeepAlive: dialer.KeepAlive,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+				return fmt.Errorf("%w: %s", ErrPrivateHost, host)
+			}
+			return nil
+		},
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if exempt != "" && addr == exempt {
+			return dialer.DialContext(ctx, network, addr)
+		}
+		return public.DialContext(ctx, network, addr)
+	}
+}
+
+// checkPublicHost returns an error if the host resolves to a private address
+func checkPublicHost(ctx context.Context, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return err
+	}
+	for _, addr := range addrs {
+		if isPrivateIP(addr.IP) {
+			return fmt.Errorf("%w: %s", ErrPrivateHost, host)
+		}
+	}
+	return nil
+}
+
+// proxyHostPort is the address the transport dials to reach the proxy
+func proxyHostPort(proxy *url.URL) string {
+	if proxy.Port() != "" {
+		return proxy.Host
+	}
+	port := "80"
+	switch proxy.Scheme {
+	case "https":
+		port = "443"
+	case "socks5", "socks5h":
+		port = "1080"
+	}
+	return net.JoinHostPort(proxy.Hostname(), port)
+}
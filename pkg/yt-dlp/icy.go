@@ -0,0 +1,81 @@
+package ytdlp
+
+import (
+	"io"
+	"strings"
+)
+
+// icyReader strips the ICY metadata out of an Icecast/Shoutcast
+// stream, the metadata is sent every metaint bytes of audio
+type icyReader struct {
+	r       io.Reader
+	metaint int
+	// remaining is how much audio there is until the next metadata
+	remaining int
+	// title is called whenever the metadata contains a stream title
+	title func(string)
+	meta  []byte
+}
+
+func newICYReader(r io.Reader, metaint int, title func(string)) *icyReader {
+	return &icyReader{
+		r:         r,
+		metaint:   metaint,
+		remaining: metaint,
+		title:     title,
+		meta:      make([]byte, 255*16),
+	}
+}
+
+func (r *icyReader) Read(p []byte) (int, error) {
+	if r.remaining == 0 {
+		// The metadata starts with its length in 16 byte blocks
+		var l [1]byte
+		if _, err := io.ReadFull(r.r, l[:]); err != nil {
+			return 0, err
+		}
+		meta := r.meta[:int(l[0])*16]
+		if _, err := io.ReadFull(r.r, meta); err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		if title, ok := parseStreamTitle(string(meta)); ok {
+			r.title(title)
+		}
+		r.remaining = r.metaint
+	}
+
+	if len(p) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.r.Read(p)
+	r.remaining -= n
+	return n, err
+}
+
+// parseStreamTitle returns the StreamTitle in the metadata,
+// it looks like: StreamTitle='Artist - Title';
+func parseStreamTitle(meta string) (string, bool) {
+	meta = strings.TrimRight(meta, "\x00")
+	const key = "StreamTitle='"
+	i := strings.Index(meta, key)
+	if i < 0 {
+		return "", false
+	}
+	meta = meta[i+len(key):]
+	// Titles may contain quotes so we look for the end of the field
+	j := strings.Index(meta, "';")
+	if j < 0 {
+		j = strings.LastIndex(meta, "'")
+	}
+	if j < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(meta[:j]), true
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
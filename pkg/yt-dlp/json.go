@@ -12,6 +12,7 @@ func unmarshalTrack(b []byte) (*Track, error) {
 		*Track
 		Duration   float64 `json:"duration"`
 		WebpageURL string  `json:"webpage_url"`
+		IEKey      string  `json:"ie_key"`
 	}{}
 	err := json.Unmarshal(b, &temp)
 	if err != nil {
@@ -24,6 +25,9 @@ func unmarshalTrack(b []byte) (*Track, error) {
 	t := temp.Track
 	t.URL = temp.WebpageURL
 	t.Duration = time.Duration(temp.Duration) * time.Second
+	if t.Extractor == "" {
+		t.Extractor = temp.IEKey
+	}
 	return t, nil
 }
 
@@ -33,6 +37,7 @@ func unmarshalPlaylist(b []byte) ([]*Track, error) {
 			*Track
 			Duration   float64 `json:"duration"`
 			WebpageURL string  `json:"webpage_url"`
+			IEKey      string  `json:"ie_key"`
 		} `json:"entries"`
 	}{}
 	err := json.Unmarshal(b, &p)
@@ -51,6 +56,10 @@ func unmarshalPlaylist(b []byte) ([]*Track, error) {
 		if p.Entries[i].WebpageURL != "" {
 			tracks[i].URL = p.Entries[i].WebpageURL
 		}
+		// Flat playlists only give us the key of the extractor
+		if tracks[i].Extractor == "" {
+			tracks[i].Extractor = p.Entries[i].IEKey
+		}
 	}
 	return tracks, nil
 }
@@ -0,0 +1,439 @@
+package ytdlp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// LibraryPrefix marks queries which search the library,
+	// e.g. "library: artist title" plays the best match and
+	// "library:album artist album" plays the whole album
+	LibraryPrefix = "library:"
+	libraryAlbum  = "album "
+)
+
+// libraryExts are the extensions of the files we index
+var libraryExts = map[string]bool{
+	".mp3":  true,
+	".flac": true,
+	".ogg":  true,
+	".opus": true,
+	".m4a":  true,
+	".wav":  true,
+}
+
+// Library indexes the music in a directory so it can be searched, the
+// index is saved to disk so only new or changed files are probed again
+type Library struct {
+	dir, indexPath string
+	// probe reads the tags of the file
+	probe func(ctx context.Context, path string) (LibraryEntry, error)
+
+	mu      sync.RWMutex
+	entries []LibraryEntry
+}
+
+// LibraryEntry is a track in the library
+type LibraryEntry struct {
+	// Path is relative to the library's dir
+	Path     string        `json:"path"`
+	Size     int64         `json:"size"`
+	ModTime  time.Time     `json:"mod_time"`
+	Artist   string        `json:"artist"`
+	Album    string        `json:"album"`
+	Title    string        `json:"title"`
+	Disc     int           `json:"disc"`
+	Number   int           `json:"number"`
+	Duration time.Duration `json:"duration"`
+	// AlbumArtist is set for compilations where the tracks' artists differ
+	AlbumArtist string `json:"album_artist,omitempty"`
+}
+
+// albumArtist returns who the album the entry is on is by
+func (e LibraryEntry) albumArtist() string {
+	if e.AlbumArtist != "" {
+		return e.AlbumArtist
+	}
+	return e.Artist
+}
+
+// NewLibrary opens the library in the dir, the index is
+// loaded from the indexPath if it's been saved before
+func NewLibrary(dir, indexPath string) (*Library, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, errors.New("library is not a directory")
+	}
+
+	l := &Library{
+		dir:       dir,
+		indexPath: indexPath,
+		probe: func(ctx context.Context, path string) (LibraryEntry, error) {
+			return ffprobe(ctx, ExecExecutor{}, "ffprobe", path)
+		},
+	}
+	data, err := os.ReadFile(indexPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &l.entries); err != nil {
+		// The index can always be rebuilt
+		log.Error().Err(err).Str("index", indexPath).Msg("failed to read library index")
+		l.entries = nil
+	}
+	return l, nil
+}
+
+// Len returns how many tracks are in the library
+func (l *Library) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.entries)
+}
+
+// Scan updates the index with the files in the dir and saves it, files
+// which haven't changed since they were last scanned aren't probed again
+func (l *Library) Scan(ctx context.Context) error {
+	l.mu.RLock()
+	old := make(map[string]LibraryEntry, len(l.entries))
+	for _, e := range l.entries {
+		old[e.Path] = e
+	}
+	l.mu.RUnlock()
+
+	var entries []LibraryEntry
+	err := filepath.WalkDir(l.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("failed to scan library")
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() || !libraryExts[strings.ToLower(filepath.Ext(path))] {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(l.dir, path)
+		if err != nil {
+			return nil
+		}
+
+		if e, ok := old[rel]; ok && e.Size == info.Size() && e.ModTime.Equal(info.ModTime()) {
+			entries = append(entries, e)
+			return nil
+		}
+		e, err := l.probe(ctx, path)
+		if err != nil {
+			log.Error().Err(err).Str("path", path).Msg("failed to probe library file")
+			return nil
+		}
+		e.Path, e.Size, e.ModTime = rel, info.Size(), info.ModTime()
+		// Untagged files are named after themselves
+		if e.Title == "" {
+			e.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.entries = entries
+	l.mu.Unlock()
+	return l.save(entries)
+}
+
+// save writes the index to disk
+func (l *Library) save(entries []LibraryEntry) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(l.indexPath, data)
+}
+
+// writeFileAtomic writes the data to the path, it's
+// renamed into place so a crash can't corrupt it
+func writeFileAtomic(path string, data []byte) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (l *Library) Search(query string) (*Track, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	terms := searchTerms(query)
+	best, bestScore := -1, 0.0
+	for i, e := range l.entries {
+		score := matchScore(terms, e.Artist+" "+e.Album+" "+e.Title)
+		if score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return nil, errors.New("no tracks found in library")
+	}
+	return l.track(l.entries[best]), nil
+}
+
+// SearchAlbum returns the tracks of the album which best matches the query
+func (l *Library) SearchAlbum(query string) ([]*Track, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	// Albums are identified by their artist and name
+	type album struct{ artist, name string }
+	terms := searchTerms(query)
+	var best album
+	var bestScore float64
+	for _, e := range l.entries {
+		if e.Album == "" {
+			continue
+		}
+		a := album{e.albumArtist(), e.Album}
+		if score := matchScore(terms, a.artist+" "+a.name); score > bestScore {
+			best, bestScore = a, score
+		}
+	}
+	if bestScore == 0 {
+		return nil, errors.New("no albums found in library")
+	}
+
+	var entries []LibraryEntry
+	for _, e := range l.entries {
+		if e.albumArtist() == best.artist && e.Album == best.name {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Disc != entries[j].Disc {
+			return entries[i].Disc < entries[j].Disc
+		}
+		if entries[i].Number != entries[j].Number {
+			return entries[i].Number < entries[j].Number
+		}
+		return entries[i].Path < entries[j].Path
+	})
+	tracks := make([]*Track, len(entries))
+	for i, e := range entries {
+		tracks[i] = l.track(e)
+	}
+	return tracks, nil
+}
+
+func (l *Library) track(e LibraryEntry) *Track {
+	return &Track{
+		ID:         e.Path,
+		VideoTitle: e.Title,
+		Uploader:   e.Artist,
+		Duration:   e.Duration,
+		URL:        e.Path,
+		Title:      e.Title,
+		Artist:     e.Artist,
+		Album:      e.Album,
+		file:       filepath.Join(l.dir, e.Path),
+	}
+}
+
+// searchLibrary handles queries which start with the LibraryPrefix
+func (c *Client) searchLibrary(query string) ([]*Track, error) {
+	if c.library == nil {
+		return nil, errors.New("library is unsupported")
+	}
+
+	query = strings.TrimSpace(query)
+	if rest, ok := cutPrefixFold(query, libraryAlbum); ok {
+		return c.library.SearchAlbum(rest)
+	}
+	t, err := c.library.Search(query)
+	if err != nil {
+		return nil, err
+	}
+	return []*Track{t}, nil
+}
+
+// searchTerms splits the text into lowercase words without punctuation
+func searchTerms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// matchScore returns how well the terms match the text, it's zero if any
+// term doesn't match. Exact words score highest, then prefixes, then
+// substrings and finally words which are only a typo away
+func matchScore(terms []string, text string) float64 {
+	if len(terms) == 0 {
+		return 0
+	}
+	words := searchTerms(text)
+
+	var total float64
+	for _, t := range terms {
+		var best float64
+		for _, w := range words {
+			var score float64
+			switch {
+			case w == t:
+				score = 1
+			case strings.HasPrefix(w, t):
+				score = 0.75
+			case strings.Contains(w, t):
+				score = 0.5
+			case len(t) >= 4 && editDistance(w, t) <= 1:
+				score = 0.5
+			}
+			if score > best {
+				best = score
+			}
+		}
+		if best == 0 {
+			return 0
+		}
+		total += best
+	}
+	// Prefer texts without many other words so
+	// "song" matches "Song" before "Song (Remix)"
+	return total/float64(len(terms)) - float64(len(words))*0.001
+}
+
+// editDistance returns the levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j-1] + cost
+			if prev[j]+1 < cur[j] {
+				cur[j] = prev[j] + 1
+			}
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// cutPrefixFold is strings.CutPrefix but case insensitive
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
+
+// ffprobe reads the tags of the file with the ffprobe binary
+func ffprobe(ctx context.Context, e Executor, bin, path string) (LibraryEntry, error) {
+	cmd := e.Command(ctx, bin,
+		"-v", "quiet", "-print_format", "json", "-show_format", "file:"+path)
+	out, err := cmd.Output()
+	if err != nil {
+		return LibraryEntry{}, err
+	}
+	return parseFFprobe(out)
+}
+
+// parseFFprobe reads the output of ffprobe's -show_format
+func parseFFprobe(data []byte) (LibraryEntry, error) {
+	var probe struct {
+		Format struct {
+			Duration string            `json:"duration"`
+			Tags     map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	err := json.Unmarshal(data, &probe)
+	if err != nil {
+		return LibraryEntry{}, err
+	}
+
+	// Tag names differ in case between formats
+	tags := make(map[string]string, len(probe.Format.Tags))
+	for k, v := range probe.Format.Tags {
+		tags[strings.ToLower(k)] = strings.TrimSpace(v)
+	}
+	var e LibraryEntry
+	e.Title = tags["title"]
+	e.Album = tags["album"]
+	e.Artist = tags["artist"]
+	e.AlbumArtist = tags["album_artist"]
+	// Numbers may be given as "3/12"
+	e.Number = leadingInt(firstTag(tags, "track", "tracknumber"))
+	e.Disc = leadingInt(firstTag(tags, "disc", "discnumber"))
+	if secs, err := strconv.ParseFloat(probe.Format.Duration, 64); err == nil {
+		e.Duration = time.Duration(secs * float64(time.Second))
+	}
+	return e, nil
+}
+
+// firstTag returns the first of the tags which is set, since
+// vorbis comments and id3 tags name some fields differently
+func firstTag(tags map[string]string, names ...string) string {
+	for _, name := range names {
+		if v := tags[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func leadingInt(s string) int {
+	s, _, _ = strings.Cut(s, "/")
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
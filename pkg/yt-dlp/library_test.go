@@ -0,0 +1,169 @@
+package ytdlp
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestLibrary creates a library whose files contain their tags as json
+func newTestLibrary(t *testing.T, files map[string]LibraryEntry) (*Library, *int) {
+	dir := t.TempDir()
+	for name, e := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "cover.jpg"), nil, 0o644)
+
+	l, err := NewLibrary(dir, filepath.Join(t.TempDir(), "index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	probes := new(int)
+	l.probe = func(ctx context.Context, path string) (LibraryEntry, error) {
+		*probes++
+		var e LibraryEntry
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return e, err
+		}
+		return e, json.Unmarshal(data, &e)
+	}
+	return l, probes
+}
+
+var testLibrary = map[string]LibraryEntry{
+	"a/1.flac": {Artist: "Sinjin Hawke", Album: "First Opus", Title: "Onset", Number: 1},
+	"a/2.flac": {Artist: "Sinjin Hawke", Album: "First Opus", Title: "Don't Even Trip", Number: 2},
+	"a/3.flac": {Artist: "Sinjin Hawke", Album: "First Opus", Title: "Bleeding Bells", Disc: 2, Number: 1},
+	"b/1.mp3":  {Artist: "Zora Jones", Album: "Vicious Circles", Title: "Bleeding Bells (Remix)"},
+	"c.mp3":    {},
+}
+
+func TestLibrarySearch(t *testing.T) {
+	l, _ := newTestLibrary(t, testLibrary)
+	if err := l.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if l.Len() != 5 {
+		t.Fatalf("expected 5 tracks but got %d", l.Len())
+	}
+
+	tests := []struct {
+		query string
+		title string
+	}{
+		{"onset", "Onset"},
+		{"sinjin bleeding", "Bleeding Bells"},
+		{"bleeding bells", "Bleeding Bells"},
+		{"zora bleeding", "Bleeding Bells (Remix)"},
+		{"dont even trip", "Don't Even Trip"},
+		{"blee", "Bleeding Bells"},
+		{"sinjn onset", "Onset"},
+		{"c", "c"},
+	}
+	for _, tc := range tests {
+		track, err := l.Search(tc.query)
+		if err != nil {
+			t.Errorf("%s: %v", tc.query, err)
+		} else if track.Title != tc.title {
+			t.Errorf("%s: expected %q but got %q", tc.query, tc.title, track.Title)
+		}
+	}
+	if _, err := l.Search("nothing like it"); err == nil {
+		t.Error("expected no match")
+	}
+
+	// Tracks are played from the library's dir
+	track, _ := l.Search("onset")
+	if track.file != filepath.Join(l.dir, "a", "1.flac") {
+		t.Errorf("invalid track file: %s", track.file)
+	}
+}
+
+func TestLibraryAlbum(t *testing.T) {
+	l, _ := newTestLibrary(t, testLibrary)
+	if err := l.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Albums are in disc then track order
+	tracks, err := l.SearchAlbum("first opus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, track := range tracks {
+		titles = append(titles, track.Title)
+	}
+	if len(titles) != 3 || titles[0] != "Onset" || titles[1] != "Don't Even Trip" || titles[2] != "Bleeding Bells" {
+		t.Errorf("invalid album: %q", titles)
+	}
+
+	c := &Client{library: l}
+	tracks, err = c.DownloadMetadata(context.Background(), "Library:album vicious")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].Album != "Vicious Circles" {
+		t.Errorf("invalid album: %v", tracks)
+	}
+}
+
+func TestLibraryIndex(t *testing.T) {
+	l, probes := newTestLibrary(t, testLibrary)
+	if err := l.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if *probes != 5 {
+		t.Errorf("expected 5 probes but got %d", *probes)
+	}
+
+	// The index is loaded again and only changed files are probed
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(filepath.Join(l.dir, "c.mp3"), old, old)
+	os.Remove(filepath.Join(l.dir, "b", "1.mp3"))
+	reopened, err := NewLibrary(l.dir, l.indexPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Len() != 5 {
+		t.Errorf("expected the index to have 5 tracks but got %d", reopened.Len())
+	}
+	reopened.probe = l.probe
+	if err := reopened.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if *probes != 6 {
+		t.Errorf("expected 1 more probe but got %d", *probes-5)
+	}
+	if reopened.Len() != 4 {
+		t.Errorf("expected removed files to be dropped but got %d tracks", reopened.Len())
+	}
+}
+
+func TestParseFFprobe(t *testing.T) {
+	e, err := parseFFprobe([]byte(`{"format": {"duration": "215.5", "tags": {
+		"TITLE": "Onset", "ARTIST": "Sinjin Hawke", "album_artist": "Various",
+		"ALBUM": "First Opus", "track": "3/12", "disc": "1/2"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LibraryEntry{Title: "Onset", Artist: "Sinjin Hawke", AlbumArtist: "Various",
+		Album: "First Opus", Number: 3, Disc: 1, Duration: 215500 * time.Millisecond}
+	if e != want {
+		t.Errorf("expected %+v but got %+v", want, e)
+	}
+}
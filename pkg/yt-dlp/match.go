@@ -0,0 +1,229 @@
+package ytdlp
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// matchThreshold is the lowest score a youtube result can
+// have to be played in place of a track from another service
+const matchThreshold = 0.65
+
+// How much each part of a match contributes to its score
+const (
+	titleWeight    = 0.4
+	artistWeight   = 0.3
+	durationWeight = 0.2
+	channelWeight  = 0.1
+	// variantPenalty is taken off for every version of the song which
+	// the original isn't, e.g. a cover or a sped up edit
+	variantPenalty = 0.3
+	// lyricsPenalty prefers the official audio over lyric videos
+	lyricsPenalty = 0.05
+)
+
+// Durations within durationSlack of each other score fully, it then
+// drops until they're durationLimit apart and is a penalty after that
+const (
+	durationSlack = 2 * time.Second
+	durationLimit = 30 * time.Second
+)
+
+var (
+	// featPattern matches the featured artists in a title, they're
+	// matched separately so they're removed from the title
+	featPattern = regexp.MustCompile(`[(\[]\s*(?:feat\.?|ft\.?|featuring|with)\s[^)\]]*[)\]]|\s(?:feat\.?|ft\.?|featuring)\s[^()\[\]-]*`)
+	// bracketPattern matches the bracketed parts of a title
+	bracketPattern = regexp.MustCompile(`[(\[][^)\]]*[)\]]`)
+	// remasterPattern matches spotify's " - Remastered 2011" suffixes
+	remasterPattern = regexp.MustCompile(`\s-\s[^-]*remaster[^-]*$`)
+)
+
+// noiseWords are brackets which only describe the upload, e.g. "(Official Video)"
+var noiseWords = map[string]bool{
+	"official": true, "video": true, "audio": true, "lyric": true, "lyrics": true,
+	"visualizer": true, "visualiser": true, "hd": true, "hq": true, "4k": true,
+	"mv": true, "music": true, "clip": true,
+}
+
+// variantWords mark versions of a song which aren't the original
+var variantWords = []string{
+	"cover", "remix", "live", "sped", "slowed", "nightcore", "reverb", "karaoke",
+	"instrumental", "acoustic", "extended", "edit", "mashup", "hour",
+}
+
+// textReplacer keeps contractions as one word and spells out "&"
+var textReplacer = strings.NewReplacer("'", "", "’", "", "&", " and ")
+
+// foldText lowercases the text and removes its accents
+func foldText(s string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	folded, _, err := transform.String(t, s)
+	if err != nil {
+		folded = s
+	}
+	return textReplacer.Replace(strings.ToLower(folded))
+}
+
+// titleWords normalises a title into its words without the featured
+// artists or any brackets which only describe the upload
+func titleWords(title string) []string {
+	title = foldText(title)
+	title = remasterPattern.ReplaceAllString(title, "")
+	title = featPattern.ReplaceAllString(title, " ")
+	title = bracketPattern.ReplaceAllStringFunc(title, func(b string) string {
+		for _, w := range searchTerms(b) {
+			if !noiseWords[w] {
+				return b
+			}
+		}
+		return " "
+	})
+	return searchTerms(title)
+}
+
+// channelName removes the " - Topic" suffix of youtube's auto-generated channels
+func channelName(uploader string) (string, bool) {
+	name := strings.TrimSuffix(uploader, " - Topic")
+	return name, name != uploader
+}
+
+// compactText is the text's words joined without spaces, so channels
+// like "SinjinHawke" still match the artist
+func compactText(s string) string {
+	return strings.Join(searchTerms(foldText(s)), "")
+}
+
+// containsPhrase returns whether the words contain the phrase's words in order
+func containsPhrase(words []string, phrase string) bool {
+	p := searchTerms(foldText(phrase))
+	if len(p) == 0 {
+		return false
+	}
+	return strings.Contains(" "+strings.Join(words, " ")+" ", " "+strings.Join(p, " ")+" ")
+}
+
+func containsWord(words []string, word string) bool {
+	for _, w := range words {
+		if w == word {
+			return true
+		}
+	}
+	return false
+}
+
+// matchInfo scores how likely the youtube track is the track
+// from 0 to 1, tracks which don't contain most of the title score 0
+func matchInfo(info trackInfo, t *Track) float64 {
+	// Most of the title has to be in the video's title,
+	// youtube music also gives us the track's actual title
+	want := titleWords(info.Title)
+	if len(want) == 0 {
+		return 0
+	}
+	got := titleWords(t.VideoTitle + " " + t.Title)
+	found := 0
+	for _, w := range want {
+		if containsWord(got, w) {
+			found++
+		}
+	}
+	titleScore := float64(found) / float64(len(want))
+	if titleScore < 0.5 {
+		return 0
+	}
+	score := titleWeight * titleScore
+
+	// Every artist should be credited somewhere in the video
+	channel, topic := channelName(t.Uploader)
+	credits := searchTerms(foldText(strings.Join([]string{t.VideoTitle, t.Artist, channel}, " ")))
+	if len(info.Artists) > 0 {
+		credited := 0
+		for _, a := range info.Artists {
+			if containsPhrase(credits, a) {
+				credited++
+			}
+		}
+		score += artistWeight * float64(credited) / float64(len(info.Artists))
+	}
+
+	// The closer the durations the better, it's neutral if either is unknown
+	if info.Duration > 0 && t.Duration > 0 {
+		diff := info.Duration - t.Duration
+		if diff < 0 {
+			diff *= -1
+		}
+		if diff <= durationSlack {
+			score += durationWeight
+		} else if diff < durationLimit {
+			score += durationWeight * float64(durationLimit-diff) / float64(durationLimit-durationSlack)
+		} else {
+			score -= durationWeight
+		}
+	} else {
+		score += durationWeight / 2
+	}
+
+	// Uploads by the artist's own or auto-generated channels are preferred
+	for _, a := range info.Artists {
+		ch, artist := compactText(channel), compactText(a)
+		if artist != "" && (ch == artist || ch == artist+"vevo" || (topic && strings.Contains(ch, artist))) {
+			score += channelWeight
+			break
+		}
+	}
+
+	// Penalise other versions of the song unless that's what we're after
+	original := searchTerms(foldText(info.Title))
+	video := searchTerms(foldText(t.VideoTitle + " " + t.Title))
+	for _, v := range variantWords {
+		if containsWord(video, v) && !containsWord(original, v) {
+			score -= variantPenalty
+		}
+	}
+	if containsWord(video, "lyrics") || containsWord(video, "lyric") {
+		score -= lyricsPenalty
+	}
+
+	if score < 0 {
+		return 0
+	}
+	return score
+}
+
+// bestMatch returns the track which best matches the info
+// or nil if none of them are above the matchThreshold
+func bestMatch(info trackInfo, tracks []*Track) (*Track, float64) {
+	var best *Track
+	var bestScore float64
+	for _, t := range tracks {
+		if score := matchInfo(info, t); score >= matchThreshold && score > bestScore {
+			best, bestScore = t, score
+		}
+	}
+	return best, bestScore
+}
+
+// rankMatches returns the tracks which are above the matchThreshold
+// ordered from the best match of the info to the worst
+func rankMatches(info trackInfo, tracks []*Track) []*Track {
+	scores := make(map[*Track]float64, len(tracks))
+	ranked := make([]*Track, 0, len(tracks))
+	for _, t := range tracks {
+		if score := matchInfo(info, t); score >= matchThreshold {
+			scores[t] = score
+			ranked = append(ranked, t)
+		}
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return scores[ranked[i]] > scores[ranked[j]]
+	})
+	return ranked
+}
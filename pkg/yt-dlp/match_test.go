@@ -0,0 +1,80 @@
+package ytdlp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTitleWords(t *testing.T) {
+	tests := []struct {
+		title string
+		words string
+	}{
+		{"Onset", "onset"},
+		{"Sinjin Hawke - Onset (Official Video)", "sinjin hawke onset"},
+		{"Onset [Official Music Video] (HD)", "onset"},
+		{"Onset (Live)", "onset live"},
+		{"Beyoncé - Halo", "beyonce halo"},
+		{"Don't Even Trip (feat. Zora Jones)", "dont even trip"},
+		{"Don't Even Trip ft. Zora Jones - Lyrics", "dont even trip lyrics"},
+		{"Simon & Garfunkel", "simon and garfunkel"},
+		{"Don’t Even Trip", "dont even trip"},
+		{"Bleeding Bells - Remastered 2011", "bleeding bells"},
+	}
+	for _, tc := range tests {
+		if words := strings.Join(titleWords(tc.title), " "); words != tc.words {
+			t.Errorf("%s: expected %q but got %q", tc.title, tc.words, words)
+		}
+	}
+}
+
+func TestMatchInfo(t *testing.T) {
+	onset := trackInfo{Artists: []string{"Sinjin Hawke"}, Title: "Onset", Duration: 245 * time.Second}
+	trip := trackInfo{Artists: []string{"Sinjin Hawke", "Zora Jones"}, Title: "Don't Even Trip (feat. Zora Jones)", Duration: 180 * time.Second}
+	live := trackInfo{Artists: []string{"Sinjin Hawke"}, Title: "Onset - Live", Duration: 400 * time.Second}
+	accents := trackInfo{Artists: []string{"Beyoncé"}, Title: "Halo", Duration: 261 * time.Second}
+
+	tests := []struct {
+		name  string
+		st    trackInfo
+		track *Track
+		match bool
+	}{
+		{"topic channel", onset, &Track{VideoTitle: "Onset", Uploader: "Sinjin Hawke - Topic", Duration: 245 * time.Second}, true},
+		{"official video", onset, &Track{VideoTitle: "Sinjin Hawke - Onset (Official Video)", Uploader: "Fractal Fantasy", Duration: 250 * time.Second}, true},
+		{"artist channel", onset, &Track{VideoTitle: "ONSET", Uploader: "SinjinHawkeVEVO", Duration: 246 * time.Second}, true},
+		{"lyric video", onset, &Track{VideoTitle: "Sinjin Hawke - Onset (Lyrics)", Uploader: "Lyrics Hub", Duration: 245 * time.Second}, true},
+		{"all artists", trip, &Track{VideoTitle: "Sinjin Hawke & Zora Jones - Don't Even Trip", Uploader: "Fractal Fantasy", Duration: 181 * time.Second}, true},
+		{"accents", accents, &Track{VideoTitle: "Beyonce - Halo", Uploader: "beyonceVEVO", Duration: 262 * time.Second}, true},
+		{"wanted variant", live, &Track{VideoTitle: "Sinjin Hawke - Onset (Live)", Uploader: "Boiler Room", Duration: 398 * time.Second}, true},
+		{"cover", onset, &Track{VideoTitle: "Onset - Sinjin Hawke (Piano Cover)", Uploader: "Pianist", Duration: 245 * time.Second}, false},
+		{"sped up", onset, &Track{VideoTitle: "Sinjin Hawke - Onset (Sped Up)", Uploader: "Speedy", Duration: 200 * time.Second}, false},
+		{"live", onset, &Track{VideoTitle: "Onset (Live)", Uploader: "Someone Else", Duration: 400 * time.Second}, false},
+		{"different song", onset, &Track{VideoTitle: "Sinjin Hawke - Don't Even Trip", Uploader: "Sinjin Hawke - Topic", Duration: 245 * time.Second}, false},
+		{"different artist", onset, &Track{VideoTitle: "Onset", Uploader: "Someone Else", Duration: 245 * time.Second}, false},
+		{"wrong length", onset, &Track{VideoTitle: "Sinjin Hawke - Onset", Uploader: "Reuploads", Duration: 500 * time.Second}, false},
+		{"missing artist", trip, &Track{VideoTitle: "Don't Even Trip", Uploader: "Reuploads", Duration: 190 * time.Second}, false},
+	}
+	for _, tc := range tests {
+		score := matchInfo(tc.st, tc.track)
+		if match := score >= matchThreshold; match != tc.match {
+			t.Errorf("%s: expected match to be %v but scored %.2f", tc.name, tc.match, score)
+		}
+	}
+}
+
+func TestBestMatch(t *testing.T) {
+	st := trackInfo{Artists: []string{"Sinjin Hawke"}, Title: "Onset", Duration: 245 * time.Second}
+	tracks := []*Track{
+		{ID: "lyrics", VideoTitle: "Sinjin Hawke - Onset (Lyrics)", Uploader: "Lyrics Hub", Duration: 245 * time.Second},
+		{ID: "topic", VideoTitle: "Onset", Uploader: "Sinjin Hawke - Topic", Duration: 245 * time.Second},
+		{ID: "cover", VideoTitle: "Onset (Cover)", Uploader: "Someone Else", Duration: 245 * time.Second},
+	}
+	if best, _ := bestMatch(st, tracks); best == nil || best.ID != "topic" {
+		t.Errorf("expected the topic channel but got %v", best)
+	}
+	if best, _ := bestMatch(st, tracks[2:]); best != nil {
+		t.Errorf("expected no match but got %v", best)
+	}
+}
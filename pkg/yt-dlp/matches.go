@@ -0,0 +1,192 @@
+package ytdlp
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// DefaultMatchTTL is how long matches are used before
+	// the tracks are searched for again
+	DefaultMatchTTL = 30 * 24 * time.Hour
+	// matchesName is the file in the CacheDir which the matches
+	// are saved to if no other file is given
+	matchesName = "matches.json"
+	// youtubeWatch is the link to the videos of matches
+	youtubeWatch = "https://www.youtube.com/watch?v="
+	// matchSaveDelay is how long new matches are batched before they're
+	// saved, playlists would otherwise rewrite the file for every track
+	matchSaveDelay = 10 * time.Second
+)
+
+// Match is the youtube video a track from another service was matched to
+type Match struct {
+	VideoID  string        `json:"video_id"`
+	Title    string        `json:"title"`
+	Uploader string        `json:"uploader"`
+	Duration time.Duration `json:"duration"`
+	Matched  time.Time     `json:"matched"`
+	// Overrides are chosen by hand, they never expire
+	Override bool `json:"override,omitempty"`
+}
+
+func newMatch(t *Track) Match {
+	return Match{
+		VideoID:  t.ID,
+		Title:    t.VideoTitle,
+		Uploader: t.Uploader,
+		Duration: t.Duration,
+		Matched:  time.Now(),
+	}
+}
+
+func (m Match) track() *Track {
+	return &Track{
+		ID:         m.VideoID,
+		Extractor:  "Youtube",
+		URL:        youtubeWatch + m.VideoID,
+		VideoTitle: m.Title,
+		Uploader:   m.Uploader,
+		Duration:   m.Duration,
+	}
+}
+
+// Matches remembers which youtube video the tracks of other services,
+// e.g. spotify, were matched to so they're played the same every time
+// without being searched for again. They're keyed by the track's id
+// on its service, see trackInfo.Key
+type Matches struct {
+	// path is where the matches are saved, they're
+	// only kept in memory if it's empty
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]Match
+	// dirty is set if there are matches which haven't been
+	// saved yet, saving is the timer which will save them
+	dirty  bool
+	saving *time.Timer
+}
+
+// NewMatches loads the matches saved at the path, matches older
+// than the ttl are searched for again unless they're overrides
+func NewMatches(path string, ttl time.Duration) (*Matches, error) {
+	if ttl <= 0 {
+		ttl = DefaultMatchTTL
+	}
+	m := &Matches{
+		path:    path,
+		ttl:     ttl,
+		entries: make(map[string]Match),
+	}
+	if path == "" {
+		return m, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return m, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &m.entries); err != nil {
+		// The matches can always be searched for again
+		log.Error().Err(err).Str("path", path).Msg("failed to read saved matches")
+		m.entries = make(map[string]Match)
+	}
+	return m, nil
+}
+
+// Get returns the match of the track with the key, ok is
+// false if it hasn't been matched or the match has expired
+func (m *Matches) Get(key string) (match Match, ok bool) {
+	if key == "" {
+		return Match{}, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	match, ok = m.entries[key]
+	if ok && m.expired(match) {
+		delete(m.entries, key)
+		return Match{}, false
+	}
+	return match, ok
+}
+
+// Set saves the match of the track with the key, matches don't
+// replace overrides unless they're overrides themselves. Overrides
+// are saved straight away, other matches are saved in batches
+func (m *Matches) Set(key string, match Match) error {
+	if key == "" {
+		return errors.New("match has no key")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if old, ok := m.entries[key]; ok && old.Override && !match.Override {
+		return nil
+	}
+	m.entries[key] = match
+	m.dirty = true
+	if match.Override {
+		return m.save()
+	}
+	if m.saving == nil && m.path != "" {
+		m.saving = time.AfterFunc(matchSaveDelay, func() {
+			if err := m.Flush(); err != nil {
+				log.Error().Err(err).Str("path", m.path).Msg("failed to save matches")
+			}
+		})
+	}
+	return nil
+}
+
+// Flush saves the matches which haven't been saved yet
+func (m *Matches) Flush() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return nil
+	}
+	return m.save()
+}
+
+func (m *Matches) expired(match Match) bool {
+	return !match.Override && time.Since(match.Matched) > m.ttl
+}
+
+// save writes the matches which haven't expired to disk,
+// it must be called with the mutex held
+func (m *Matches) save() error {
+	if m.saving != nil {
+		m.saving.Stop()
+		m.saving = nil
+	}
+	if m.path == "" {
+		return nil
+	}
+	for key, match := range m.entries {
+		if m.expired(match) {
+			delete(m.entries, key)
+		}
+	}
+	data, err := json.Marshal(m.entries)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.path, data); err != nil {
+		return err
+	}
+	m.dirty = false
+	return nil
+}
@@ -0,0 +1,64 @@
+package ytdlp
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "matches.json")
+	m, err := NewMatches(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old := Match{VideoID: "old", Matched: time.Now().Add(-2 * time.Hour)}
+	if err := m.Set("spotify:track:a", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set("spotify:track:b", Match{VideoID: "b", Matched: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.Get("spotify:track:a"); ok {
+		t.Error("expired match was used")
+	}
+
+	// Overrides aren't replaced by searches and never expire
+	old.Override = true
+	if err := m.Set("spotify:track:a", old); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set("spotify:track:a", Match{VideoID: "new", Matched: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The matches are loaded from disk
+	m, err = NewMatches(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match, ok := m.Get("spotify:track:a"); !ok || match.VideoID != "old" {
+		t.Errorf("expected the override but got %+v", match)
+	}
+	if match, ok := m.Get("spotify:track:b"); !ok || match.VideoID != "b" {
+		t.Errorf("expected the saved match but got %+v", match)
+	}
+	if _, ok := m.Get(""); ok {
+		t.Error("tracks without keys shouldn't be matched")
+	}
+
+	// Matches which aren't overrides are saved in batches
+	if err := m.Set("spotify:track:c", Match{VideoID: "c", Matched: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := NewMatches(path, time.Hour); len(saved.entries) != 2 {
+		t.Errorf("expected the match to not be saved yet but got %+v", saved.entries)
+	}
+	if err := m.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := NewMatches(path, time.Hour); len(saved.entries) != 3 {
+		t.Errorf("expected the match to be saved but got %+v", saved.entries)
+	}
+}
@@ -0,0 +1,89 @@
+package ytdlp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// trackInfo is the metadata of a track from a service which yt-dlp
+// can't download from, e.g. spotify, so it's searched for on youtube
+type trackInfo struct {
+	Artists  []string
+	Title    string
+	Duration time.Duration
+	// Key identifies the track on its service, e.g. spotify:track:id,
+	// the youtube video it's matched to is saved under it
+	Key string
+}
+
+// infoResolver resolves urls from services which yt-dlp can't download
+// from, the metadata of their tracks is searched for on youtube
+type infoResolver interface {
+	Resolver
+	infos(ctx context.Context, c *Client, u *url.URL) ([]trackInfo, error)
+}
+
+// resolveInfos is the Resolve of every infoResolver, the tracks are
+// placeholders which are only searched for once they're downloaded
+// so large playlists can be queued without searching for every track
+func resolveInfos(ctx context.Context, c *Client, r infoResolver, u *url.URL) ([]*Track, error) {
+	infos, err := r.infos(ctx, c, u)
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]*Track, len(infos))
+	for i, info := range infos {
+		tracks[i] = newPlaceholder(info)
+	}
+	return tracks, nil
+}
+
+// fetch requests the url with the client's proxy
+func (c *Client) fetch(ctx context.Context, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return c.do(req)
+}
+
+// do sends the request, responses which aren't ok are an error
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	client := c.http
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// getJSON decodes the json at the url into v
+func (c *Client) getJSON(ctx context.Context, u string, v interface{}) error {
+	resp, err := c.fetch(ctx, u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// expandLink follows the redirects of a short link to the url it's for
+func (c *Client) expandLink(ctx context.Context, u *url.URL) (*url.URL, error) {
+	resp, err := c.fetch(ctx, u.String())
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Request.URL, nil
+}
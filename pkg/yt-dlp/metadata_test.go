@@ -0,0 +1,267 @@
+package ytdlp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serviceRoutes are the responses of the music services for each
+// host and request uri, which are the fixtures in testdata/services
+var serviceRoutes = map[string]string{
+	"api.deezer.com/track/3135556":                        "deezer_track.json",
+	"api.deezer.com/track/1":                              "deezer_error.json",
+	"api.deezer.com/album/302127/tracks":                  "deezer_album.json",
+	"api.deezer.com/album/302127/tracks?index=2":          "deezer_album_2.json",
+	"itunes.apple.com/lookup?country=us&id=1440834053":    "apple_song.json",
+	"itunes.apple.com/lookup?country=us&entity=song&id=1": "apple_album.json",
+	"music.apple.com/us/playlist/surf/pl.u-surf":          "apple_playlist.html",
+	"tidal.com/browse/track/12345678":                     "tidal_track.html",
+	"tidal.com/browse/album/1234567":                      "tidal_album.html",
+}
+
+// serviceTransport sends every request to the stand-in server
+type serviceTransport struct {
+	srv *httptest.Server
+}
+
+func (t serviceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req.Clone(req.Context())
+	r.URL.Scheme = "http"
+	r.URL.Host = t.srv.Listener.Addr().String()
+	r.Host = req.URL.Host
+	resp, err := http.DefaultTransport.RoundTrip(r)
+	if err == nil {
+		resp.Request = req
+	}
+	return resp, err
+}
+
+// newServiceClient is a client whose requests to the music services
+// are answered by a stand-in server
+func newServiceClient(t *testing.T) *Client {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Short links redirect to the real link
+		if r.Host == "link.deezer.com" {
+			http.Redirect(w, r, "https://www.deezer.com/en/track/3135556", http.StatusFound)
+			return
+		}
+		if r.Host == "www.deezer.com" {
+			return
+		}
+
+		name, ok := serviceRoutes[r.Host+r.URL.RequestURI()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", "services", name))
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+
+	c, _ := newTestClient()
+	c.http = &http.Client{Transport: serviceTransport{srv}}
+	return c
+}
+
+func TestServiceResolve(t *testing.T) {
+	c := newServiceClient(t)
+	links := []string{
+		"https://www.deezer.com/en/track/3135556",
+		"https://link.deezer.com/s/onset",
+		"https://music.apple.com/us/album/first-opus/1?i=1440834053",
+		"https://music.apple.com/us/song/onset/1440834053",
+		"https://tidal.com/browse/track/12345678",
+		"https://listen.tidal.com/track/12345678",
+	}
+	for _, link := range links {
+		tracks, err := c.DownloadMetadata(ctx, link)
+		if err != nil {
+			t.Errorf("%s: %v", link, err)
+		} else if err := resolvePlaceholders(c, tracks); err != nil {
+			t.Errorf("%s: %v", link, err)
+		} else if len(tracks) != 1 || tracks[0].ID != "dceGIpBtQZo" {
+			t.Errorf("%s: invalid tracks: %v", link, tracks)
+		}
+	}
+
+	if _, err := c.DownloadMetadata(ctx, "https://www.deezer.com/track/1"); err == nil || !strings.Contains(err.Error(), "no data") {
+		t.Errorf("expected deezer's error but got: %v", err)
+	}
+}
+
+// resolvePlaceholders searches for the placeholders like they would be
+// once they're downloaded
+func resolvePlaceholders(c *Client, tracks []*Track) error {
+	for _, t := range tracks {
+		if err := c.resolvePlaceholder(ctx, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestPlaceholders(t *testing.T) {
+	c := newServiceClient(t)
+	found, err := c.DownloadMetadata(ctx, "https://www.deezer.com/en/track/3135556")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("invalid tracks: %v", found)
+	}
+
+	// The placeholder is shown with deezer's metadata until it's downloaded
+	track := found[0]
+	if track.URL != "" || track.Pretty() != "`Sinjin Hawke` - `Onset`" || track.Duration != 245*time.Second {
+		t.Errorf("invalid placeholder: %+v", track)
+	}
+	var buf bytes.Buffer
+	if err := c.DownloadTrack(ctx, track, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if track.ID != "dceGIpBtQZo" || buf.String() != "opus:audio:https://www.youtube.com/watch?v=dceGIpBtQZo" {
+		t.Errorf("invalid resolved track: %+v %q", track, buf.String())
+	}
+
+	// Placeholders which can't be found aren't downloaded
+	unknown := newPlaceholder(trackInfo{Artists: []string{"Someone"}, Title: "Unknown"})
+	if err := c.DownloadTrack(ctx, unknown, io.Discard); !errors.Is(err, ErrNoMatch) {
+		t.Errorf("expected no match but got: %v", err)
+	}
+
+	// Searches stop once the placeholder's lookups are cancelled,
+	// e.g. if it's cleared from the queue, and nothing else is tried
+	lookups, cancel := context.WithCancel(ctx)
+	cancel()
+	cleared := newPlaceholder(*track.info)
+	cleared.lookups = lookups
+	if err := c.downloadRetrying(ctx, cleared, io.Discard); !errors.Is(err, context.Canceled) || cleared.URL != "" {
+		t.Errorf("expected the search to be cancelled but got %+v: %v", cleared, err)
+	}
+}
+
+func titles(infos []trackInfo) string {
+	var s []string
+	for _, info := range infos {
+		s = append(s, info.Title)
+	}
+	return strings.Join(s, ", ")
+}
+
+func TestServiceInfos(t *testing.T) {
+	c := newServiceClient(t)
+
+	// Every page of deezer's albums is read
+	infos, err := c.deezerInfos(ctx, "album", "302127")
+	if err != nil {
+		t.Error(err)
+	} else if titles(infos) != "Onset, Don't Even Trip, Bleeding Bells" || infos[2].Duration != 232*time.Second {
+		t.Errorf("invalid deezer album: %+v", infos)
+	}
+
+	// Apple music albums are in disc then track order
+	infos, err = c.appleInfos(ctx, appleLink{kind: "album", id: "1", country: "us"})
+	if err != nil {
+		t.Error(err)
+	} else if titles(infos) != "Onset, Don't Even Trip, Bleeding Bells" {
+		t.Errorf("invalid apple music album: %+v", infos)
+	}
+
+	infos, err = c.pageInfos(ctx, "https://music.apple.com/us/playlist/surf/pl.u-surf")
+	if err != nil {
+		t.Error(err)
+	} else if titles(infos) != "Onset, And You Were One" || infos[1].Artists[0] != "Zora Jones" {
+		t.Errorf("invalid apple music playlist: %+v", infos)
+	}
+
+	// Tracks of albums use the album's artist
+	infos, err = c.pageInfos(ctx, "https://tidal.com/browse/album/1234567")
+	if err != nil {
+		t.Error(err)
+	} else if titles(infos) != "Onset, Don't Even Trip" || infos[1].Artists[0] != "Sinjin Hawke" || infos[1].Duration != 201*time.Second {
+		t.Errorf("invalid tidal album: %+v", infos)
+	}
+}
+
+func TestServiceLinks(t *testing.T) {
+	tests := []struct {
+		link string
+		kind string
+		id   string
+	}{
+		{"https://www.deezer.com/track/3135556", "track", "3135556"},
+		{"https://www.deezer.com/fr/album/302127?utm_source=deezer", "album", "302127"},
+		{"https://deezer.com/us/playlist/908622995", "playlist", "908622995"},
+		{"https://www.deezer.com/en/artist/27", "", ""},
+		{"https://www.deezer.com/en/track/abc", "", ""},
+	}
+	for _, tc := range tests {
+		u, _ := url.Parse(tc.link)
+		kind, id, err := parseDeezerLink(u)
+		if tc.kind == "" && err == nil {
+			t.Errorf("%s: expected an error but got %s %s", tc.link, kind, id)
+		} else if tc.kind != "" && (kind != tc.kind || id != tc.id) {
+			t.Errorf("%s: expected %s %s but got %s %s (%v)", tc.link, tc.kind, tc.id, kind, id, err)
+		}
+	}
+
+	appleTests := []struct {
+		link string
+		want appleLink
+	}{
+		{"https://music.apple.com/us/album/first-opus/1440834000", appleLink{"album", "1440834000", "us"}},
+		{"https://music.apple.com/gb/album/first-opus/1440834000?i=1440834053", appleLink{"song", "1440834053", "gb"}},
+		{"https://music.apple.com/us/song/onset/1440834053", appleLink{"song", "1440834053", "us"}},
+		{"https://music.apple.com/song/1440834053", appleLink{"song", "1440834053", ""}},
+		{"https://itunes.apple.com/us/album/first-opus/id1440834000", appleLink{"album", "1440834000", "us"}},
+		{"https://music.apple.com/us/playlist/surf/pl.u-surf", appleLink{"playlist", "pl.u-surf", "us"}},
+		{"https://music.apple.com/us/artist/sinjin-hawke/1", appleLink{}},
+		{"https://music.apple.com/us/album/first-opus/abc", appleLink{}},
+		{"https://music.apple.com/us", appleLink{}},
+	}
+	for _, tc := range appleTests {
+		u, _ := url.Parse(tc.link)
+		link, err := parseAppleLink(u)
+		if tc.want.kind == "" && err == nil {
+			t.Errorf("%s: expected an error but got %+v", tc.link, link)
+		} else if tc.want.kind != "" && link != tc.want {
+			t.Errorf("%s: expected %+v but got %+v (%v)", tc.link, tc.want, link, err)
+		}
+	}
+
+	tidalTests := []struct {
+		link string
+		kind string
+		id   string
+	}{
+		{"https://tidal.com/browse/track/12345678", "track", "12345678"},
+		{"https://listen.tidal.com/album/1234567", "album", "1234567"},
+		{"https://tidal.com/playlist/0c8f2f5a-1b2c-4d3e-8f9a-0b1c2d3e4f5a", "playlist", "0c8f2f5a-1b2c-4d3e-8f9a-0b1c2d3e4f5a"},
+		{"https://tidal.com/browse/artist/1", "", ""},
+	}
+	for _, tc := range tidalTests {
+		u, _ := url.Parse(tc.link)
+		kind, id, err := parseTidalLink(u)
+		if tc.kind == "" && err == nil {
+			t.Errorf("%s: expected an error but got %s %s", tc.link, kind, id)
+		} else if tc.kind != "" && (kind != tc.kind || id != tc.id) {
+			t.Errorf("%s: expected %s %s but got %s %s (%v)", tc.link, tc.kind, tc.id, kind, id, err)
+		}
+	}
+}
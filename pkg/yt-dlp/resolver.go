@@ -0,0 +1,116 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// ErrNoResolver is returned if no resolver handles the url
+var ErrNoResolver = errors.New("no resolver for this url")
+
+// Resolver turns urls from a source into tracks
+type Resolver interface {
+	// Name of the source the resolver handles
+	Name() string
+	// Match returns whether the resolver handles the url
+	Match(u *url.URL) bool
+	// Resolve returns the tracks at the url
+	Resolve(ctx context.Context, c *Client, u *url.URL) ([]*Track, error)
+}
+
+// Register adds the resolver to the client, resolvers are
+// consulted in the order they're registered and the first
+// one which matches the url is used. Links which no resolver
+// matches are treated as links to audio files or live streams
+func (c *Client) Register(r Resolver) {
+	c.resolvers = append(c.resolvers, r)
+}
+
+// resolver returns the resolver which handles the url
+func (c *Client) resolver(u *url.URL) (Resolver, error) {
+	for _, r := range c.resolvers {
+		if r.Match(u) {
+			return r, nil
+		}
+	}
+	if c.fallback != nil && c.fallback.Match(u) {
+		return c.fallback, nil
+	}
+	return nil, ErrNoResolver
+}
+
+// defaultResolvers are the resolvers every client starts with
+func defaultResolvers() []Resolver {
+	return []Resolver{
+		spotifyResolver{},
+		appleResolver{},
+		deezerResolver{},
+		tidalResolver{},
+		linkResolver{name: "youtube", hosts: []string{"youtu.be", "youtube.com", "www.youtube.com", "m.youtube.com", "music.youtube.com"}},
+		linkResolver{name: "soundcloud", hosts: []string{"soundcloud.com", "www.soundcloud.com", "m.soundcloud.com"}},
+		linkResolver{name: "bandcamp", suffix: ".bandcamp.com"},
+	}
+}
+
+// linkResolver handles urls which yt-dlp can download directly
+type linkResolver struct {
+	name  string
+	hosts []string
+	// suffix matches any subdomain if it's set
+	suffix string
+}
+
+func (r linkResolver) Name() string {
+	return r.name
+}
+
+func (r linkResolver) Match(u *url.URL) bool {
+	host := hostname(u)
+	if r.suffix != "" && strings.HasSuffix(host, r.suffix) {
+		return true
+	}
+	for _, h := range r.hosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+func (r linkResolver) Resolve(ctx context.Context, c *Client, u *url.URL) ([]*Track, error) {
+	return c.searchLink(ctx, u.String())
+}
+
+// spotifyResolver downloads the metadata of spotify tracks
+// and then searches for them on youtube
+type spotifyResolver struct{}
+
+func (spotifyResolver) Name() string {
+	return "spotify"
+}
+
+func (spotifyResolver) Match(u *url.URL) bool {
+	if strings.EqualFold(u.Scheme, "spotify") {
+		return true
+	}
+	host := hostname(u)
+	return host == "spotify.com" || strings.HasSuffix(host, ".spotify.com")
+}
+
+func (r spotifyResolver) Resolve(ctx context.Context, c *Client, u *url.URL) ([]*Track, error) {
+	return resolveInfos(ctx, c, r, u)
+}
+
+func (spotifyResolver) infos(ctx context.Context, c *Client, u *url.URL) ([]trackInfo, error) {
+	if c.spotify == nil {
+		return nil, errors.New("spotify is unsupported")
+	}
+	return c.spotify.Download(ctx, u.String())
+}
+
+// hostname returns the url's host without its port in lowercase
+func hostname(u *url.URL) string {
+	return strings.ToLower(u.Hostname())
+}
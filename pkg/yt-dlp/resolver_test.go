@@ -0,0 +1,88 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+)
+
+func TestResolverMatch(t *testing.T) {
+	c := &Client{resolvers: defaultResolvers()}
+	tests := []struct {
+		url      string
+		resolver string
+	}{
+		{"https://youtu.be/dceGIpBtQZo", "youtube"},
+		{"https://www.youtube.com/watch?v=LYzM3oWC8p8", "youtube"},
+		{"https://youtube.com/watch?v=LYzM3oWC8p8", "youtube"},
+		{"https://m.youtube.com/watch?v=LYzM3oWC8p8", "youtube"},
+		{"https://music.youtube.com/watch?v=LYzM3oWC8p8", "youtube"},
+		{"https://WWW.YouTube.com:443/watch?v=LYzM3oWC8p8", "youtube"},
+		{"https://soundcloud.com/fractalfantasy/sinjin-hawke-blank-spaces-1", "soundcloud"},
+		{"https://m.soundcloud.com/fractalfantasy/sinjin-hawke-blank-spaces-1", "soundcloud"},
+		{"https://artist.bandcamp.com/track/song", "bandcamp"},
+		{"https://open.spotify.com/track/3Pb9QabepyR9e9D8NqorPH", "spotify"},
+		{"spotify:track:3Pb9QabepyR9e9D8NqorPH", "spotify"},
+		{"https://music.apple.com/us/album/first-opus/1440834000", "apple music"},
+		{"https://www.deezer.com/en/track/3135556", "deezer"},
+		{"https://deezer.page.link/abc", "deezer"},
+		{"https://tidal.com/browse/track/12345678", "tidal"},
+		{"https://listen.tidal.com/track/12345678", "tidal"},
+		{"https://example.com/watch?v=LYzM3oWC8p8", ""},
+		{"https://notspotify.com/track/3Pb9QabepyR9e9D8NqorPH", ""},
+		{"https://youtube.com.example.com/watch", ""},
+		{"https://bandcamp.com/discover", ""},
+	}
+
+	for _, tc := range tests {
+		u, err := url.Parse(tc.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := c.resolver(u)
+		if tc.resolver == "" {
+			if !errors.Is(err, ErrNoResolver) {
+				t.Errorf("%s: expected no resolver but got: %v", tc.url, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.url, err)
+		} else if r.Name() != tc.resolver {
+			t.Errorf("%s: expected %s resolver but got %s", tc.url, tc.resolver, r.Name())
+		}
+	}
+}
+
+type testResolver struct {
+	host   string
+	tracks []*Track
+}
+
+func (r testResolver) Name() string          { return "test" }
+func (r testResolver) Match(u *url.URL) bool { return u.Host == r.host }
+
+func (r testResolver) Resolve(ctx context.Context, c *Client, u *url.URL) ([]*Track, error) {
+	return r.tracks, nil
+}
+
+func TestRegister(t *testing.T) {
+	c := &Client{resolvers: defaultResolvers()}
+
+	_, err := c.DownloadMetadata(context.Background(), "https://example.com/track")
+	if !errors.Is(err, ErrNoResolver) {
+		t.Errorf("expected no resolver but got: %v", err)
+	}
+
+	// Registered resolvers are used for the urls they match
+	tracks := []*Track{{ID: "track"}}
+	c.Register(testResolver{host: "example.com", tracks: tracks})
+	got, err := c.DownloadMetadata(context.Background(), "https://example.com/track")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0] != tracks[0] {
+		t.Errorf("invalid tracks: %v", got)
+	}
+}
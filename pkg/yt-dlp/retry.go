@@ -0,0 +1,200 @@
+package ytdlp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// downloadAttempts is how many times a track is downloaded
+	// if it keeps failing with transient errors
+	downloadAttempts = 3
+	// defaultBackoff is how long until a download is retried,
+	// it's doubled after each attempt
+	defaultBackoff = 2 * time.Second
+	// alternateResults is how many youtube results are
+	// tried if a track which was searched for fails
+	alternateResults = 5
+)
+
+// transientErrors are the messages of failures which may not
+// happen again, e.g. when youtube is rate limiting us
+var transientErrors = []string{
+	"HTTP Error 429",
+	"Too Many Requests",
+	"HTTP Error 500",
+	"HTTP Error 502",
+	"HTTP Error 503",
+	"HTTP Error 504",
+	"timed out",
+	"Connection reset",
+	"Temporary failure in name resolution",
+	"IncompleteRead",
+}
+
+// isTransient returns whether the download may succeed if it's tried
+// again, errors such as region blocks and removed videos are permanent
+func isTransient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrPrivateHost) {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var procErr *ProcessError
+	if errors.As(err, &procErr) {
+		for _, msg := range transientErrors {
+			if strings.Contains(procErr.Stderr, msg) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// newLogID creates the id which correlates the logs of a track's download
+func newLogID() string {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// countWriter counts what's been written since downloads
+// can't be retried once any of the track has been played
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+// downloadRetrying downloads the track like DownloadTrack but transient
+// errors are retried with exponential backoff. If it still can't be
+// downloaded then tracks which were searched for are substituted with
+// the next search result or with soundcloud's, see Track.Substitute
+func (c *Client) downloadRetrying(ctx context.Context, t *Track, w io.Writer) error {
+	tLog := log.With().Str("id", t.LogID()).Str("track", t.Pretty()).Logger()
+	cw := &countWriter{w: w}
+	err := c.downloadAttempts(ctx, t, cw, tLog)
+	// The placeholder's search is cancelled if it's cleared from the queue
+	if err == nil || cw.n > 0 || ctx.Err() != nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	alts, altErr := c.alternates(ctx, t)
+	if altErr != nil {
+		tLog.Error().Err(altErr).Msg("failed to find alternates")
+	}
+	for _, alt := range alts {
+		// The substitute is set first so it's known once it plays
+		t.substitute.Store(alt)
+		altLog := tLog.With().Str("alternate", alt.URL).Logger()
+		altLog.Info().Msg("trying alternate")
+		altErr := c.downloadAttempts(ctx, alt, cw, altLog)
+		if altErr == nil {
+			altLog.Info().Msg("downloaded alternate")
+			return nil
+		}
+		if cw.n > 0 || ctx.Err() != nil {
+			return altErr
+		}
+	}
+	t.substitute.Store(nil)
+	tLog.Error().Err(err).Int("alternates", len(alts)).Msg("no alternates could be downloaded")
+	return err
+}
+
+// downloadAttempts downloads the track, retrying it if it fails with
+// transient errors whilst nothing has been written
+func (c *Client) downloadAttempts(ctx context.Context, t *Track, cw *countWriter, tLog zerolog.Logger) error {
+	backoff := c.backoff
+	for attempt := 1; ; attempt++ {
+		err := c.DownloadTrack(ctx, t, cw)
+		if err == nil {
+			tLog.Debug().Int("attempt", attempt).Msg("downloaded track")
+			return nil
+		}
+		transient := isTransient(err)
+		tLog.Warn().Err(err).Int("attempt", attempt).Bool("transient", transient).Msg("failed to download track")
+		if !transient || attempt >= downloadAttempts || cw.n > 0 {
+			return err
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+// alternates are the tracks to try if t can't be downloaded. Tracks from
+// other services are substituted with the youtube results which also match
+// them and then with soundcloud's, tracks from text searches with the next
+// youtube results and then soundcloud's. Other tracks have none
+func (c *Client) alternates(ctx context.Context, t *Track) ([]*Track, error) {
+	t.Lock()
+	info, query, id, resolved := t.info, t.query, t.ID, t.URL != ""
+	t.Unlock()
+
+	var searches []string
+	switch {
+	case info != nil:
+		text := strings.Join(info.Artists, " ") + " " + info.Title
+		searches = []string{fmt.Sprintf("ytsearch%d: %s", alternateResults, text), "scsearch3: " + text}
+		// Placeholders which weren't found on youtube can only be on soundcloud
+		if !resolved {
+			searches = searches[1:]
+		}
+	case query != "":
+		searches = []string{fmt.Sprintf("ytsearch%d:%s", alternateResults, query), "scsearch1:" + query}
+	default:
+		return nil, nil
+	}
+
+	var alts []*Track
+	var errs []error
+	for _, search := range searches {
+		buf, err := c.ytdlpMetadata(ctx, search, info != nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		tracks, err := unmarshalPlaylist(buf)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		// Substitutes of tracks from other services must still match them
+		if info != nil {
+			tracks = rankMatches(*info, tracks)
+		}
+		for _, alt := range tracks {
+			if alt.ID != id && alt.URL != "" {
+				alts = append(alts, alt)
+			}
+		}
+	}
+	if len(alts) == 0 && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return alts, nil
+}
@@ -0,0 +1,67 @@
+package ytdlp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		err       error
+		transient bool
+	}{
+		{&ProcessError{Name: "yt-dlp", Stderr: "ERROR: unable to download video data: HTTP Error 429: Too Many Requests"}, true},
+		{&ProcessError{Name: "yt-dlp", Stderr: "ERROR: [youtube] abc: Read timed out."}, true},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{&ProcessError{Name: "yt-dlp", Stderr: "ERROR: [youtube] abc: Video unavailable"}, false},
+		{&ProcessError{Name: "yt-dlp", Stderr: "ERROR: The uploader has not made this video available in your country"}, false},
+		{&ProcessError{Name: "ffmpeg", Stderr: "Invalid data found when processing input"}, false},
+		{context.Canceled, false},
+		{&net.OpError{Op: "dial", Err: ErrPrivateHost}, false},
+	}
+	for _, tc := range tests {
+		if isTransient(tc.err) != tc.transient {
+			t.Errorf("%v: expected transient to be %t", tc.err, tc.transient)
+		}
+	}
+}
+
+func TestDownloadRetrying(t *testing.T) {
+	c, e := newTestClient()
+	c.backoff = time.Millisecond
+
+	// Transient errors are retried until we give up
+	limited := &Track{ID: "ratelimited", Extractor: "Youtube", URL: "https://www.youtube.com/watch?v=ratelimited"}
+	err := c.downloadRetrying(ctx, limited, io.Discard)
+	var procErr *ProcessError
+	if !errors.As(err, &procErr) || !isTransient(err) {
+		t.Errorf("expected the rate limit error but got: %v", err)
+	}
+	if calls := e.calls.Load(); calls != 2*downloadAttempts {
+		t.Errorf("expected %d attempts but ran %d commands", downloadAttempts, calls)
+	}
+
+	// Searched for tracks are substituted with the next result
+	broken := &Track{ID: "broken", Extractor: "Youtube", URL: "https://www.youtube.com/watch?v=broken", query: "sinjin hawke onset"}
+	var buf bytes.Buffer
+	if err := c.downloadRetrying(ctx, broken, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if sub := broken.Substitute(); sub == nil || sub.ID != "xxxxxxxxxx1" {
+		t.Errorf("invalid substitute: %+v", sub)
+	}
+	if buf.String() != "opus:audio:https://www.youtube.com/watch?v=xxxxxxxxxx1" {
+		t.Errorf("invalid track: %q", buf.String())
+	}
+
+	// Links have nothing to fall back to
+	link := &Track{ID: "broken", Extractor: "Youtube", URL: "https://www.youtube.com/watch?v=broken"}
+	if err := c.downloadRetrying(ctx, link, io.Discard); err == nil || link.Substitute() != nil {
+		t.Errorf("expected the link to fail but got %v, %+v", err, link.Substitute())
+	}
+}
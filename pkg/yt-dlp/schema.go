@@ -0,0 +1,204 @@
+package ytdlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPageSize limits how much of a page is read for its metadata
+const maxPageSize = 8 * 1024 * 1024
+
+// schemaItem is the schema.org metadata of a song, album or playlist
+// which music services embed in their pages as json-ld
+type schemaItem struct {
+	Type     string        `json:"@type"`
+	Name     string        `json:"name"`
+	Duration string        `json:"duration"`
+	ByArtist schemaArtists `json:"byArtist"`
+	Track    schemaTracks  `json:"track"`
+	// Graph holds the items if there's more than one
+	Graph []schemaItem `json:"@graph"`
+}
+
+// schemaArtists is either a single artist or a list of them
+type schemaArtists []string
+
+func (a *schemaArtists) UnmarshalJSON(b []byte) error {
+	type artist struct {
+		Name string `json:"name"`
+	}
+	var artists []artist
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		if err := json.Unmarshal(b, &artists); err != nil {
+			return err
+		}
+	} else {
+		var single artist
+		if err := json.Unmarshal(b, &single); err != nil {
+			return err
+		}
+		artists = append(artists, single)
+	}
+
+	for _, artist := range artists {
+		if artist.Name != "" {
+			*a = append(*a, artist.Name)
+		}
+	}
+	return nil
+}
+
+// schemaTracks is a list of songs or an ItemList of them
+type schemaTracks []schemaItem
+
+func (t *schemaTracks) UnmarshalJSON(b []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		return json.Unmarshal(b, (*[]schemaItem)(t))
+	}
+
+	var list struct {
+		Elements []struct {
+			Item schemaItem `json:"item"`
+		} `json:"itemListElement"`
+	}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return err
+	}
+	for _, e := range list.Elements {
+		*t = append(*t, e.Item)
+	}
+	return nil
+}
+
+func (s schemaItem) info(artists []string) trackInfo {
+	if len(s.ByArtist) > 0 {
+		artists = s.ByArtist
+	}
+	d, _ := parseISODuration(s.Duration)
+	return trackInfo{
+		Artists:  artists,
+		Title:    s.Name,
+		Duration: d,
+	}
+}
+
+// infos returns the songs the item is or contains, the
+// artist of an album is used if its songs don't have one
+func (s schemaItem) infos() []trackInfo {
+	switch s.Type {
+	case "MusicRecording":
+		return []trackInfo{s.info(nil)}
+	case "MusicAlbum", "MusicPlaylist":
+		infos := make([]trackInfo, 0, len(s.Track))
+		for _, t := range s.Track {
+			infos = append(infos, t.info(s.ByArtist))
+		}
+		return infos
+	}
+
+	var infos []trackInfo
+	for _, item := range s.Graph {
+		infos = append(infos, item.infos()...)
+	}
+	return infos
+}
+
+// parseSchema reads the songs from the json-ld scripts in the page
+func parseSchema(page []byte) ([]trackInfo, error) {
+	var infos []trackInfo
+	for {
+		i := bytes.Index(page, []byte("application/ld+json"))
+		if i < 0 {
+			break
+		}
+		page = page[i:]
+		start := bytes.IndexByte(page, '>')
+		end := bytes.Index(page, []byte("</script>"))
+		if start < 0 || end < start {
+			break
+		}
+		script := page[start+1 : end]
+		page = page[end:]
+
+		// Scripts can hold a single item or a list of them
+		var items []schemaItem
+		if bytes.HasPrefix(bytes.TrimSpace(script), []byte("[")) {
+			if err := json.Unmarshal(script, &items); err != nil {
+				return nil, err
+			}
+		} else {
+			var item schemaItem
+			if err := json.Unmarshal(script, &item); err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		for _, item := range items {
+			infos = append(infos, item.infos()...)
+		}
+	}
+
+	if len(infos) == 0 {
+		return nil, errors.New("page has no song metadata")
+	}
+	return infos, nil
+}
+
+// pageInfos reads the songs from the schema.org metadata of the page
+func (c *Client) pageInfos(ctx context.Context, u string) ([]trackInfo, error) {
+	resp, err := c.fetch(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageSize))
+	if err != nil {
+		return nil, err
+	}
+	return parseSchema(page)
+}
+
+// parseISODuration parses ISO 8601 durations such as PT4M5S
+func parseISODuration(s string) (time.Duration, error) {
+	rest, ok := strings.CutPrefix(strings.ToUpper(s), "P")
+	if !ok {
+		return 0, errors.New("invalid duration: " + s)
+	}
+
+	var d time.Duration
+	units := map[byte]time.Duration{'D': 24 * time.Hour, 'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+	inTime := false
+	num := ""
+	for i := 0; i < len(rest); i++ {
+		ch := rest[i]
+		switch {
+		case ch == 'T':
+			inTime = true
+		case '0' <= ch && ch <= '9' || ch == '.':
+			num += string(ch)
+		default:
+			unit, ok := units[ch]
+			// M before the T is months, which no song lasts
+			if !ok || num == "" || (ch == 'M' && !inTime) {
+				return 0, errors.New("invalid duration: " + s)
+			}
+			n, err := strconv.ParseFloat(num, 64)
+			if err != nil {
+				return 0, err
+			}
+			d += time.Duration(n * float64(unit))
+			num = ""
+		}
+	}
+	if num != "" {
+		return 0, errors.New("invalid duration: " + s)
+	}
+	return d, nil
+}
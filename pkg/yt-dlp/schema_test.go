@@ -0,0 +1,51 @@
+package ytdlp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseISODuration(t *testing.T) {
+	tests := []struct {
+		s string
+		d time.Duration
+	}{
+		{"PT4M5S", 245 * time.Second},
+		{"PT1H0M2S", time.Hour + 2*time.Second},
+		{"PT0.5S", 500 * time.Millisecond},
+		{"P1DT1M", 24*time.Hour + time.Minute},
+		{"PT245S", 245 * time.Second},
+	}
+	for _, tc := range tests {
+		d, err := parseISODuration(tc.s)
+		if err != nil {
+			t.Errorf("%s: %v", tc.s, err)
+		} else if d != tc.d {
+			t.Errorf("%s: expected %s but got %s", tc.s, tc.d, d)
+		}
+	}
+	for _, s := range []string{"", "4M5S", "P1M", "PT4X", "PT4"} {
+		if _, err := parseISODuration(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	page := `<script type="application/ld+json">[
+		{"@type": "WebSite", "name": "Music"},
+		{"@graph": [{"@type": "MusicRecording", "name": "Onset", "byArtist": {"name": "Sinjin Hawke"}}]}
+	]</script>
+	<script type='application/ld+json'>{"@type": "MusicRecording", "name": "And You Were One", "byArtist": [{"name": "Zora Jones"}, {"name": "Sinjin Hawke"}]}</script>`
+	infos, err := parseSchema([]byte(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 2 || infos[0].Title != "Onset" || len(infos[1].Artists) != 2 {
+		t.Errorf("invalid infos: %+v", infos)
+	}
+
+	if _, err := parseSchema([]byte(`<script type="application/ld+json">{"@type": "WebSite"}</script>`)); err == nil {
+		t.Error("expected an error for a page without songs")
+	}
+}
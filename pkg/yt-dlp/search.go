@@ -2,16 +2,16 @@ package ytdlp
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"sort"
+	"net/url"
 	"strings"
-	"time"
+
+	"github.com/rs/zerolog/log"
 )
 
-type search struct {
-	T    *Track
-	Diff time.Duration
-}
+// ErrNoMatch is returned when a placeholder track can't be found on youtube
+var ErrNoMatch = errors.New("no match found on youtube")
 
 func (c *Client) searchLink(ctx context.Context, link string) ([]*Track, error) {
 	buf, err := c.ytdlpMetadata(ctx, link, false)
@@ -36,22 +36,34 @@ func (c *Client) searchLink(ctx context.Context, link string) ([]*Track, error)
 }
 
 func (c *Client) searchQuery(ctx context.Context, text string) (*Track, error) {
-	buf, err := c.ytdlpMetadata(ctx, "ytsearch1:"+text, false)
+	t, err := c.Search(ctx, text, 1)
 	if err != nil {
 		return nil, err
 	}
+	t[0].query = text
+	return t[0], nil
+}
 
-	t, err := unmarshalPlaylist(buf)
+// Search returns the top n youtube results for the text
+func (c *Client) Search(ctx context.Context, text string, n int) ([]*Track, error) {
+	buf, err := c.ytdlpMetadata(ctx, fmt.Sprintf("ytsearch%d:%s", n, text), false)
 	if err != nil {
 		return nil, err
 	}
-
-	return t[0], nil
+	return unmarshalPlaylist(buf)
 }
 
-func (c *Client) searchSpotify(ctx context.Context, st spotifyTrack) (*Track, error) {
-	// First we perform the search
-	buf, err := c.ytdlpMetadata(ctx, fmt.Sprintf("ytsearch5: %s %s", st.Artist, st.Title), true)
+func (c *Client) searchInfo(ctx context.Context, info trackInfo) (*Track, error) {
+	// Tracks which have been matched before are played the same
+	if m, ok := c.matches.Get(info.Key); ok {
+		log.Debug().Str("title", info.Title).Str("key", info.Key).Str("video", m.VideoID).
+			Bool("override", m.Override).Msg("using saved match")
+		t := m.track()
+		t.info = &info
+		return t, nil
+	}
+
+	buf, err := c.ytdlpMetadata(ctx, fmt.Sprintf("ytsearch5: %s %s", strings.Join(info.Artists, " "), info.Title), true)
 	if err != nil {
 		return nil, err
 	}
@@ -60,30 +72,93 @@ func (c *Client) searchSpotify(ctx context.Context, st spotifyTrack) (*Track, er
 		return nil, err
 	}
 
-	// Now filter the searches
-	filtered := make([]search, 0)
-	for _, track := range tracks {
-		diff := st.Duration - track.Duration
-		if diff < 0 {
-			diff *= -1
+	// Results which aren't confidently the same song are rejected,
+	// it's better to skip the track than play the wrong one
+	t, score := bestMatch(info, tracks)
+	if t == nil {
+		return nil, fmt.Errorf("no confident match for %s - %s", strings.Join(info.Artists, ", "), info.Title)
+	}
+	log.Debug().Str("title", info.Title).Str("match", t.VideoTitle).Float64("score", score).Msg("matched track")
+	t.info = &info
+	if info.Key != "" && t.Extractor == "Youtube" {
+		if err := c.matches.Set(info.Key, newMatch(t)); err != nil {
+			log.Error().Err(err).Str("key", info.Key).Msg("failed to save match")
+		}
+	}
+	return t, nil
+}
+
+// resolvePlaceholder searches youtube for the track if it's a placeholder,
+// its source's title, artist and duration are kept so it's shown the same
+func (c *Client) resolvePlaceholder(ctx context.Context, t *Track) error {
+	t.Lock()
+	info, resolved, lookups := t.info, t.URL != "", t.lookups
+	t.Unlock()
+	if info == nil || resolved {
+		return nil
+	}
+	if lookups != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = withLookups(ctx, lookups)
+		defer cancel()
+	}
+
+	found, err := c.searchInfo(ctx, *info)
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
+		return fmt.Errorf("%w: %v", ErrNoMatch, err)
+	}
+
+	t.Lock()
+	defer t.Unlock()
+	t.ID, t.Extractor, t.URL = found.ID, found.Extractor, found.URL
+	t.VideoTitle, t.Uploader = found.VideoTitle, found.Uploader
+	return nil
+}
 
-		containsArtist := strings.Contains(track.Artist, st.Artist)
-		containsTitle := strings.Contains(track.Title, st.Title)
-		if containsArtist && containsTitle {
-			filtered = append(filtered, search{
-				T:    track,
-				Diff: diff,
-			})
+// withLookups returns a ctx which is also cancelled once lookups is done
+func withLookups(ctx, lookups context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-lookups.Done():
+			cancel()
+		case <-ctx.Done():
 		}
+	}()
+	return ctx, cancel
+}
+
+// OverrideMatch makes the spotify track or episode at the link always
+// play the youtube video, it fixes tracks which were matched wrongly
+func (c *Client) OverrideMatch(ctx context.Context, link, video string) (*Track, error) {
+	kind, id, err := parseSpotifyLink(link)
+	if err != nil {
+		return nil, err
 	}
-	if len(filtered) == 0 {
-		return tracks[0], nil
+	if kind != "track" && kind != "episode" {
+		return nil, errors.New("only spotify tracks and episodes can be matched")
+	}
+	if _, err := url.ParseRequestURI(video); err != nil {
+		return nil, errors.New("invalid youtube link")
+	}
+
+	tracks, err := c.DownloadMetadata(ctx, video)
+	if err != nil {
+		return nil, err
+	}
+	if len(tracks) != 1 || tracks[0].Extractor != "Youtube" {
+		return nil, errors.New("the match must be a single youtube video")
 	}
 
-	// If we managed to find some tracks
-	sort.SliceStable(filtered, func(i, j int) bool {
-		return filtered[i].Diff < filtered[j].Diff
-	})
-	return filtered[0].T, nil
+	m := newMatch(tracks[0])
+	m.Override = true
+	key := spotifyKey(kind, id)
+	if err := c.matches.Set(key, m); err != nil {
+		return nil, err
+	}
+	log.Info().Str("key", key).Str("video", m.VideoID).Msg("overrode match")
+	return tracks[0], nil
 }
@@ -2,60 +2,126 @@ package ytdlp
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/rs/zerolog/log"
 	"github.com/zmb3/spotify/v2"
 	spotifyauth "github.com/zmb3/spotify/v2/auth"
 	"golang.org/x/oauth2/clientcredentials"
 	"golang.org/x/time/rate"
 )
 
-type spotifyClient struct {
-	id, secret string
-	rl         *rate.Limiter
-	client     *spotify.Client
-}
+// spotifyAPI is the url of the real spotify api
+const spotifyAPI = "https://api.spotify.com/v1/"
 
-type spotifyTrack struct {
-	Artist   string
-	Title    string
-	Duration time.Duration
+type spotifyClient struct {
+	cfg    ClientConfig
+	rl     *rate.Limiter
+	client *spotify.Client
+	// http is authorised to request the endpoints the client doesn't support
+	http *http.Client
 }
 
-func createClient(id, secret string) (*spotify.Client, error) {
+func createClient(cfg ClientConfig) (*spotify.Client, *http.Client, error) {
 	ctx := context.Background()
 	config := &clientcredentials.Config{
-		ClientID:     id,
-		ClientSecret: secret,
+		ClientID:     cfg.SpotifyID,
+		ClientSecret: cfg.SpotifySecret,
 		TokenURL:     spotifyauth.TokenURL,
 	}
+	if cfg.SpotifyTokenURL != "" {
+		config.TokenURL = cfg.SpotifyTokenURL
+	}
 	token, err := config.Token(ctx)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	httpClient := spotifyauth.New().Client(ctx, token)
-	return spotify.New(httpClient), nil
+	var opts []spotify.ClientOption
+	if cfg.SpotifyURL != "" {
+		opts = append(opts, spotify.WithBaseURL(cfg.SpotifyURL))
+	}
+	return spotify.New(httpClient, opts...), httpClient, nil
 }
 
-func newSpotifyClient(id, secret string) *spotifyClient {
-	c, _ := createClient(id, secret)
-	if c == nil {
+func newSpotifyClient(cfg ClientConfig) *spotifyClient {
+	c, httpClient, err := createClient(cfg)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create spotify client")
 		return nil
 	}
 
 	return &spotifyClient{
 		client: c,
-		id:     id,
-		secret: secret,
+		http:   httpClient,
+		cfg:    cfg,
 		rl:     rate.NewLimiter(rate.Every(time.Second/time.Duration(MaxRequestsPerSec)), 1),
 	}
 }
 
-func (s *spotifyClient) Download(ctx context.Context, link string) ([]spotifyTrack, error) {
-	u, err := url.ParseRequestURI(link)
+// spotifyKinds are the types of link which can be played
+var spotifyKinds = map[string]bool{
+	"track":    true,
+	"album":    true,
+	"playlist": true,
+	"artist":   true,
+	"show":     true,
+	"episode":  true,
+}
+
+// parseSpotifyLink returns the type and id of what the link points to. Links
+// are either urls, which may be localised e.g. /intl-de/track/id or embedded
+// e.g. /embed/track/id, or they're uris e.g. spotify:track:id
+func parseSpotifyLink(link string) (string, spotify.ID, error) {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return "", "", err
+	}
+
+	var parts []string
+	if strings.EqualFold(u.Scheme, "spotify") {
+		parts = strings.Split(u.Opaque, ":")
+	} else {
+		parts = strings.Split(strings.Trim(u.Path, "/"), "/")
+	}
+
+	// The id follows the type, anything before them
+	// e.g. the user who owns a playlist is ignored
+	for i := len(parts) - 2; i >= 0; i-- {
+		kind := strings.ToLower(parts[i])
+		if spotifyKinds[kind] && isSpotifyID(parts[i+1]) {
+			return kind, spotify.ID(parts[i+1]), nil
+		}
+	}
+	return "", "", errors.New("invalid spotify link type")
+}
+
+// spotifyKey identifies spotify tracks and episodes for their matches
+func spotifyKey(kind string, id spotify.ID) string {
+	return "spotify:" + kind + ":" + string(id)
+}
+
+// isSpotifyID returns whether the id is base62
+func isSpotifyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *spotifyClient) Download(ctx context.Context, link string) ([]trackInfo, error) {
+	kind, id, err := parseSpotifyLink(link)
 	if err != nil {
 		return nil, err
 	}
@@ -68,80 +134,113 @@ func (s *spotifyClient) Download(ctx context.Context, link string) ([]spotifyTra
 	// Recreate the client if the token has expired
 	token, err := s.client.Token()
 	if err != nil || !token.Valid() {
-		c, err := createClient(s.id, s.secret)
+		c, httpClient, err := createClient(s.cfg)
 		if err != nil {
 			return nil, err
 		}
 		s.client = c
+		s.http = httpClient
 	}
 
-	if strings.Contains(u.Path, "track") {
-		t, err := s.track(ctx, spotify.ID(strings.TrimPrefix(u.Path, "/track/")))
+	switch kind {
+	case "track":
+		t, err := s.track(ctx, id)
 		if err != nil {
 			return nil, err
 		}
-		return []spotifyTrack{t}, nil
-	} else if strings.Contains(u.Path, "album") {
-		return s.album(ctx, spotify.ID(strings.TrimPrefix(u.Path, "/album/")))
-	} else if strings.Contains(u.Path, "playlist") {
-		return s.playlist(ctx, spotify.ID(strings.TrimPrefix(u.Path, "/playlist/")))
+		return []trackInfo{t}, nil
+	case "album":
+		return s.album(ctx, id)
+	case "playlist":
+		return s.playlist(ctx, id)
+	case "artist":
+		return s.artist(ctx, id)
+	case "show":
+		return s.show(ctx, id)
+	case "episode":
+		t, err := s.episode(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		return []trackInfo{t}, nil
 	}
 
 	return nil, errors.New("invalid spotify link type")
 }
 
-func (s *spotifyClient) spotifyTrack(t interface{}) spotifyTrack {
-	var st spotifyTrack
+func (s *spotifyClient) info(t interface{}) trackInfo {
+	var st trackInfo
 
 	full, ok := t.(*spotify.FullTrack)
 	if ok {
-		st.Artist = full.Artists[0].Name
+		st.Artists = artistNames(full.Artists)
 		st.Title = full.Name
 		st.Duration = full.TimeDuration()
+		st.Key = spotifyKey("track", full.ID)
 	}
 	simple, ok := t.(*spotify.SimpleTrack)
 	if ok {
-		st.Artist = simple.Artists[0].Name
+		st.Artists = artistNames(simple.Artists)
 		st.Title = simple.Name
 		st.Duration = simple.TimeDuration()
+		st.Key = spotifyKey("track", simple.ID)
 	}
 
 	return st
 }
 
-func (s *spotifyClient) track(ctx context.Context, uri spotify.ID) (spotifyTrack, error) {
+func artistNames(artists []spotify.SimpleArtist) []string {
+	names := make([]string, len(artists))
+	for i, a := range artists {
+		names[i] = a.Name
+	}
+	return names
+}
+
+func (s *spotifyClient) track(ctx context.Context, uri spotify.ID) (trackInfo, error) {
 	t, err := s.client.GetTrack(ctx, uri)
 	if err != nil {
-		return spotifyTrack{}, err
+		return trackInfo{}, err
 	}
-	return s.spotifyTrack(t), nil
+	return s.info(t), nil
 }
 
-func (s *spotifyClient) album(ctx context.Context, uri spotify.ID) ([]spotifyTrack, error) {
+func (s *spotifyClient) album(ctx context.Context, uri spotify.ID) ([]trackInfo, error) {
 	tracks, err := s.client.GetAlbumTracks(ctx, uri)
 	if err != nil {
 		return nil, err
 	}
 
-	data := make([]spotifyTrack, len(tracks.Tracks))
-	for i, t := range tracks.Tracks {
-		data[i] = s.spotifyTrack(&t)
+	totalTracks := make([]trackInfo, 0, tracks.Total)
+	for {
+		for _, t := range tracks.Tracks {
+			totalTracks = append(totalTracks, s.info(&t))
+		}
+
+		// Long albums are split into pages
+		err = s.client.NextPage(ctx, tracks)
+		if err == spotify.ErrNoMorePages {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
 	}
-	return data, nil
+	return totalTracks, nil
 }
 
-func (s *spotifyClient) playlist(ctx context.Context, uri spotify.ID) ([]spotifyTrack, error) {
+func (s *spotifyClient) playlist(ctx context.Context, uri spotify.ID) ([]trackInfo, error) {
 	tracks, err := s.client.GetPlaylistTracks(ctx, uri)
 	if err != nil {
 		return nil, err
 	}
 
-	totalTracks := make([]spotifyTrack, 0)
+	totalTracks := make([]trackInfo, 0)
 	for page := 1; ; page++ {
 		// Make the data
-		data := make([]spotifyTrack, len(tracks.Tracks))
+		data := make([]trackInfo, len(tracks.Tracks))
 		for i, t := range tracks.Tracks {
-			data[i] = s.spotifyTrack(&t.Track)
+			data[i] = s.info(&t.Track)
 		}
 		totalTracks = append(totalTracks, data...)
 
@@ -156,3 +255,78 @@ func (s *spotifyClient) playlist(ctx context.Context, uri spotify.ID) ([]spotify
 	}
 	return totalTracks, nil
 }
+
+// artist returns the artist's top tracks
+func (s *spotifyClient) artist(ctx context.Context, uri spotify.ID) ([]trackInfo, error) {
+	tracks, err := s.client.GetArtistsTopTracks(ctx, uri, s.cfg.SpotifyMarket)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]trackInfo, len(tracks))
+	for i, t := range tracks {
+		data[i] = s.info(&t)
+	}
+	return data, nil
+}
+
+func (s *spotifyClient) show(ctx context.Context, uri spotify.ID) ([]trackInfo, error) {
+	show, err := s.client.GetShow(ctx, uri, spotify.Market(s.cfg.SpotifyMarket))
+	if err != nil {
+		return nil, err
+	}
+
+	episodes := &show.Episodes
+	totalTracks := make([]trackInfo, 0, episodes.Total)
+	for {
+		for _, e := range episodes.Episodes {
+			totalTracks = append(totalTracks, episodeTrack(show.SimpleShow, e))
+		}
+
+		err = s.client.NextPage(ctx, episodes)
+		if err == spotify.ErrNoMorePages {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return totalTracks, nil
+}
+
+// episode requests the episode itself since the spotify client can't
+func (s *spotifyClient) episode(ctx context.Context, uri spotify.ID) (trackInfo, error) {
+	base := spotifyAPI
+	if s.cfg.SpotifyURL != "" {
+		base = s.cfg.SpotifyURL
+	}
+	q := url.Values{"market": {s.cfg.SpotifyMarket}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base+"episodes/"+string(uri)+"?"+q.Encode(), nil)
+	if err != nil {
+		return trackInfo{}, err
+	}
+	resp, err := s.http.Do(req)
+	if err != nil {
+		return trackInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return trackInfo{}, fmt.Errorf("could not get episode: %s", resp.Status)
+	}
+
+	var e spotify.EpisodePage
+	if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+		return trackInfo{}, err
+	}
+	return episodeTrack(e.Show, e), nil
+}
+
+// episodeTrack searches for the episode by the show's name, the duration
+// is left out since uploads of podcasts rarely have the same length
+func episodeTrack(show spotify.SimpleShow, e spotify.EpisodePage) trackInfo {
+	return trackInfo{
+		Artists: []string{show.Name},
+		Title:   e.Name,
+		Key:     spotifyKey("episode", e.ID),
+	}
+}
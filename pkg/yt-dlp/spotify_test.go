@@ -1,69 +1,288 @@
 package ytdlp
 
 import (
-	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/rs/zerolog/log"
 	"github.com/zmb3/spotify/v2"
 )
 
 var (
-	sc *spotifyClient
-
-	trackURI    spotify.ID = "5aH0gOvX64uaomC5TE2YJz"
-	albumURI    spotify.ID = "2Vx9FC6Um8i6kEtY7HNswB"
+	trackURI    spotify.ID = "3Pb9QabepyR9e9D8NqorPH"
+	albumURI    spotify.ID = "0QMxX4ZCFZK3ku24sviec4"
 	playlistURI spotify.ID = "37i9dQZF1DX8tZsk68tuDw"
+	artistURI   spotify.ID = "2ITh1ZRSAHkV2awzWWZkBP"
+	showURI     spotify.ID = "5CfCWKI5pZ28U0uOzXkDHe"
+	episodeURI  spotify.ID = "512ojhOuo1ktJprKbVcKyQ"
 )
 
-func init() {
-	sc = newSpotifyClient(os.Getenv("SPOTIFY_ID"), os.Getenv("SPOTIFY_SECRET"))
+// newSpotifyServer serves the recorded responses in testdata/spotify
+func newSpotifyServer(t *testing.T) ClientConfig {
+	routes := map[string]string{
+		"/api/token":                                       "token.json",
+		"/v1/tracks/" + string(trackURI):                   "track.json",
+		"/v1/albums/" + string(albumURI) + "/tracks":       "album_tracks.json",
+		"/v1/playlists/" + string(playlistURI) + "/tracks": "playlist_tracks.json",
+		"/v1/artists/" + string(artistURI) + "/top-tracks": "artist_top_tracks.json",
+		"/v1/shows/" + string(showURI):                     "show.json",
+		"/v1/shows/" + string(showURI) + "/episodes":       "show_episodes.json",
+		"/v1/episodes/" + string(episodeURI):               "episode.json",
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := routes[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		// Like the real api, podcasts and top tracks are only available
+		// in the market or country they're requested for
+		q := r.URL.Query()
+		regional := strings.HasPrefix(r.URL.Path, "/v1/shows/") || strings.HasPrefix(r.URL.Path, "/v1/episodes/") ||
+			strings.HasPrefix(r.URL.Path, "/v1/artists/")
+		if regional && q.Get("market") == "" && q.Get("country") == "" {
+			http.Error(w, "missing market", http.StatusBadRequest)
+			return
+		}
+		// Later pages are stored separately
+		if r.URL.Query().Get("offset") == "2" {
+			name = strings.TrimSuffix(name, ".json") + "_2.json"
+		}
+		data, err := os.ReadFile(filepath.Join("testdata", "spotify", name))
+		if err != nil {
+			t.Error(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(strings.ReplaceAll(string(data), "{{server}}", srv.URL)))
+	}))
+	t.Cleanup(srv.Close)
+
+	return ClientConfig{
+		SpotifyID:       "id",
+		SpotifySecret:   "secret",
+		SpotifyURL:      srv.URL + "/v1/",
+		SpotifyTokenURL: srv.URL + "/api/token",
+	}
+}
+
+func newTestSpotifyClient(t *testing.T) *spotifyClient {
+	sc := newSpotifyClient(newSpotifyServer(t).withDefaults())
 	if sc == nil {
-		log.Fatal().Err(fmt.Errorf("could not create spotify client")).Send()
+		t.Fatal("could not create spotify client")
 	}
+	return sc
 }
 
 func TestSpotifyTrack(t *testing.T) {
+	sc := newTestSpotifyClient(t)
 	st, err := sc.track(ctx, trackURI)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if len(st.Artists) != 1 || st.Artists[0] != "Sinjin Hawke" || st.Title != "Onset" || st.Duration.Seconds() != 245 {
+		t.Errorf("invalid track: %+v", st)
 	}
-	fmt.Println("Spotify Track:", st)
 }
 
 func TestSpotifyAlbum(t *testing.T) {
+	sc := newTestSpotifyClient(t)
 	st, err := sc.album(ctx, albumURI)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	// Every page of the album should be downloaded
+	if len(st) != 3 || st[1].Title != "Don't Even Trip" || len(st[2].Artists) != 2 {
+		t.Errorf("invalid album: %+v", st)
+	}
+}
+
+func TestSpotifyArtist(t *testing.T) {
+	sc := newTestSpotifyClient(t)
+	st, err := sc.artist(ctx, artistURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st) != 2 || st[0].Title != "Onset" {
+		t.Errorf("invalid top tracks: %+v", st)
+	}
+}
+
+func TestSpotifyShow(t *testing.T) {
+	sc := newTestSpotifyClient(t)
+	st, err := sc.show(ctx, showURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(st) != 3 || st[2].Title != "Episode 1" || st[2].Artists[0] != "Fractal Fantasy Radio" {
+		t.Errorf("invalid show: %+v", st)
+	}
+
+	e, err := sc.episode(ctx, episodeURI)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Title != "Episode 3" || e.Artists[0] != "Fractal Fantasy Radio" || e.Duration != 0 {
+		t.Errorf("invalid episode: %+v", e)
 	}
-	fmt.Println("Spotify Album:", st)
 }
 
 func TestSpotifyPlaylist(t *testing.T) {
+	sc := newTestSpotifyClient(t)
 	st, err := sc.playlist(ctx, playlistURI)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	// Every page of the playlist should be downloaded
+	if len(st) != 3 || st[2].Title != "And You Were One" {
+		t.Errorf("invalid playlist: %+v", st)
 	}
-	fmt.Println("Spotify Playlist:", st)
 }
 
 func TestSpotifyDownload(t *testing.T) {
-	st, err := sc.Download(ctx, "https://open.spotify.com/track/3Pb9QabepyR9e9D8NqorPH?si=4f75dad081f4430b")
-	if err != nil {
-		t.Error(err)
+	sc := newTestSpotifyClient(t)
+	tests := []struct {
+		link   string
+		tracks int
+	}{
+		{"https://open.spotify.com/track/3Pb9QabepyR9e9D8NqorPH?si=4f75dad081f4430b", 1},
+		{"https://open.spotify.com/album/0QMxX4ZCFZK3ku24sviec4?si=gYf5pWPZSm27FbzCJNzr6g", 3},
+		{"https://open.spotify.com/playlist/37i9dQZF1DX8tZsk68tuDw?si=3c8edaa8116a4f14", 3},
+		{"https://open.spotify.com/intl-de/album/0QMxX4ZCFZK3ku24sviec4", 3},
+		{"https://open.spotify.com/artist/2ITh1ZRSAHkV2awzWWZkBP", 2},
+		{"https://open.spotify.com/show/5CfCWKI5pZ28U0uOzXkDHe", 3},
+		{"https://open.spotify.com/episode/512ojhOuo1ktJprKbVcKyQ", 1},
+		{"spotify:track:3Pb9QabepyR9e9D8NqorPH", 1},
 	}
-	fmt.Println("Spotify Track (download len):", len(st))
+	for _, tc := range tests {
+		st, err := sc.Download(ctx, tc.link)
+		if err != nil {
+			t.Errorf("%s: %v", tc.link, err)
+		} else if len(st) != tc.tracks {
+			t.Errorf("%s: expected %d tracks but got %d", tc.link, tc.tracks, len(st))
+		}
+	}
+}
+
+func TestParseSpotifyLink(t *testing.T) {
+	tests := []struct {
+		link string
+		kind string
+		id   spotify.ID
+	}{
+		{"https://open.spotify.com/track/3Pb9QabepyR9e9D8NqorPH?si=4f75dad081f4430b", "track", trackURI},
+		{"https://open.spotify.com/intl-de/track/3Pb9QabepyR9e9D8NqorPH", "track", trackURI},
+		{"https://open.spotify.com/embed/album/0QMxX4ZCFZK3ku24sviec4?utm_source=generator", "album", albumURI},
+		{"https://open.spotify.com/user/spotify/playlist/37i9dQZF1DX8tZsk68tuDw", "playlist", playlistURI},
+		{"https://open.spotify.com/artist/2ITh1ZRSAHkV2awzWWZkBP/", "artist", artistURI},
+		{"https://open.spotify.com/show/5CfCWKI5pZ28U0uOzXkDHe", "show", showURI},
+		{"https://open.spotify.com/intl-pt/episode/512ojhOuo1ktJprKbVcKyQ", "episode", episodeURI},
+		{"spotify:track:3Pb9QabepyR9e9D8NqorPH", "track", trackURI},
+		{"spotify:user:spotify:playlist:37i9dQZF1DX8tZsk68tuDw", "playlist", playlistURI},
+		{"Spotify:Album:0QMxX4ZCFZK3ku24sviec4", "album", albumURI},
+		{"https://open.spotify.com/", "", ""},
+		{"https://open.spotify.com/track/", "", ""},
+		{"https://open.spotify.com/track/../me", "", ""},
+		{"https://open.spotify.com/genre/pop", "", ""},
+		{"spotify:track", "", ""},
+	}
+	for _, tc := range tests {
+		kind, id, err := parseSpotifyLink(tc.link)
+		if tc.kind == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error but got %s %s", tc.link, kind, id)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.link, err)
+		} else if kind != tc.kind || id != tc.id {
+			t.Errorf("%s: expected %s %s but got %s %s", tc.link, tc.kind, tc.id, kind, id)
+		}
+	}
+}
 
-	st, err = sc.Download(ctx, "https://open.spotify.com/album/0QMxX4ZCFZK3ku24sviec4?si=gYf5pWPZSm27FbzCJNzr6g")
+func TestSpotifySearch(t *testing.T) {
+	cfg := newSpotifyServer(t)
+	e := &fakeExecutor{}
+	cfg.Executor = e
+	c := NewClient(cfg)
+
+	// The youtube video whose metadata matches the spotify track is picked
+	tracks, err := c.DownloadMetadata(ctx, "https://open.spotify.com/track/3Pb9QabepyR9e9D8NqorPH?si=4f75dad081f4430b")
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if err := resolvePlaceholders(c, tracks); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].ID != "dceGIpBtQZo" {
+		t.Errorf("invalid tracks: %v", tracks)
+	}
+}
+
+func TestSpotifySearchRejected(t *testing.T) {
+	c, _ := newTestClient()
+
+	// None of the results are by the artist so they're all rejected
+	st := trackInfo{Artists: []string{"Someone"}, Title: "Onset", Duration: 245 * time.Second}
+	if track, err := c.searchInfo(ctx, st); err == nil {
+		t.Errorf("expected no match but got %v", track)
+	}
+}
+
+func TestSpotifyMatches(t *testing.T) {
+	cfg := newSpotifyServer(t)
+	e := &fakeExecutor{}
+	cfg.Executor = e
+	cfg.CacheDir = t.TempDir()
+	c := NewClient(cfg)
+
+	// Tracks are only searched for the first time they're played
+	link := "https://open.spotify.com/track/3Pb9QabepyR9e9D8NqorPH"
+	for i := 0; i < 2; i++ {
+		tracks, err := c.DownloadMetadata(ctx, link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := resolvePlaceholders(c, tracks); err != nil {
+			t.Fatal(err)
+		}
+		if len(tracks) != 1 || tracks[0].ID != "dceGIpBtQZo" || tracks[0].URL != youtubeWatch+"dceGIpBtQZo" {
+			t.Errorf("invalid tracks: %v", tracks)
+		}
+	}
+	if calls := e.calls.Load(); calls != 1 {
+		t.Errorf("expected yt-dlp to search once but ran %d commands", calls)
 	}
-	fmt.Println("Spotify Album (download len):", len(st))
 
-	st, err = sc.Download(ctx, "https://open.spotify.com/playlist/37i9dQZF1DX4dyzvuaRJ0n?si=3c8edaa8116a4f14")
+	// Overrides replace the match and are saved for new clients
+	if _, err := c.OverrideMatch(ctx, link, "https://www.youtube.com/watch?v=LYzM3oWC8p8"); err != nil {
+		t.Fatal(err)
+	}
+	c = NewClient(cfg)
+	tracks, err := c.DownloadMetadata(ctx, link)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	if err := resolvePlaceholders(c, tracks); err != nil {
+		t.Fatal(err)
+	}
+	if len(tracks) != 1 || tracks[0].ID != "LYzM3oWC8p8" {
+		t.Errorf("invalid overridden tracks: %v", tracks)
+	}
+
+	if _, err := c.OverrideMatch(ctx, "https://open.spotify.com/album/1", "https://www.youtube.com/watch?v=LYzM3oWC8p8"); err == nil {
+		t.Error("expected albums to not be overridden")
+	}
+	if _, err := c.OverrideMatch(ctx, link, youtubePlaylist); err == nil {
+		t.Error("expected playlists to not be matches")
 	}
-	fmt.Println("Spotify Playlist (download len):", len(st))
 }
@@ -0,0 +1,306 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxStderr is how much of the end of each process's stderr is kept
+	maxStderr = 16 * 1024
+	// waitDelay is how long to wait for a killed process's output to close
+	waitDelay = 5 * time.Second
+)
+
+// ProcessError is returned when yt-dlp or ffmpeg fails, it
+// holds the end of the process's stderr to explain why
+type ProcessError struct {
+	Name   string
+	Err    error
+	Stderr string
+}
+
+func (e *ProcessError) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s failed: %s", e.Name, e.Err)
+	}
+	return fmt.Sprintf("%s failed: %s: %s", e.Name, e.Err, e.Stderr)
+}
+
+func (e *ProcessError) Unwrap() error {
+	return e.Err
+}
+
+// Stream is the output of yt-dlp piped through ffmpeg, it must be closed
+// once it's been read so that both processes are cleaned up. If either
+// process fails then both are killed and reading returns a *ProcessError
+type Stream struct {
+	producer, consumer *exec.Cmd
+	// out is the stdout of the consumer
+	out *os.File
+	// cancel kills both processes
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stderr of the producer and consumer
+	producerLog, consumerLog tailBuffer
+	// wg waits for both processes to exit
+	wg sync.WaitGroup
+
+	mu sync.Mutex
+	// err is why the first process to fail failed
+	err error
+}
+
+// Stream downloads the track at the url and returns it as an opus encoded
+// ogg stream, yt-dlp's output is piped straight into ffmpeg as it downloads
+func (c *Client) Stream(ctx context.Context, url string) (*Stream, error) {
+	err := c.rl.Wait(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	args := c.ytdlpArgs([]string{
+		"-q", "-v", "-f", "ba[vcodec=none]",
+		"--compat-options", "no-youtube-unavailable-videos",
+		"-o", "-",
+	})
+	dl := c.cfg.Executor.Command(ctx, c.cfg.YtdlpPath, append(args, url)...)
+	return startStream(ctx, cancel, dl, c.encodeCmd(ctx, "-"))
+}
+
+// streamDirect downloads the track from its url itself rather than
+// with yt-dlp and returns it as an opus encoded ogg stream. If the
+// track is live then the titles in its ICY metadata are sent to it
+func (c *Client) streamDirect(ctx context.Context, t *Track) (*Stream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	resp, err := c.get(ctx, t.URL)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	var src io.Reader = resp.Body
+	if metaint, err := strconv.Atoi(resp.Header.Get("icy-metaint")); err == nil && metaint > 0 {
+		src = newICYReader(resp.Body, metaint, t.setStreamTitle)
+	}
+	s, err := startEncode(ctx, cancel, src, c.encodeCmd(ctx, "-"))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	// The body is closed once ffmpeg has finished reading it
+	go func() {
+		s.wg.Wait()
+		resp.Body.Close()
+	}()
+	return s, nil
+}
+
+// streamFile encodes the file as an opus encoded ogg stream
+func (c *Client) streamFile(ctx context.Context, path string) (*Stream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	// ffmpeg reads the file itself since some formats need to be seeked
+	return startEncode(ctx, cancel, nil, c.encodeCmd(ctx, path))
+}
+
+// encodeCmd returns ffmpeg encoding the input to opus, "-" is its stdin
+func (c *Client) encodeCmd(ctx context.Context, input string) *exec.Cmd {
+	if input != "-" {
+		// Stop files named like flags being treated as them
+		input = "file:" + input
+	}
+	args := []string{
+		"-i", input,
+		"-hide_banner", "-loglevel", "error", "-vn",
+		"-c:a", "libopus", "-b:a", "96k", "-vbr", "off", "-application", "audio",
+	}
+	args = append(args, c.cfg.FFmpegArgs...)
+	args = append(args, "-f", "opus", "-")
+	return c.cfg.Executor.Command(ctx, c.cfg.FFmpegPath, args...)
+}
+
+// startEncode starts the consumer reading from the src, the
+// cancel func must cancel the ctx of the consumer
+func startEncode(ctx context.Context, cancel context.CancelFunc, src io.Reader, consumer *exec.Cmd) (*Stream, error) {
+	s := &Stream{
+		consumer: consumer,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	consumer.Stderr = &s.consumerLog
+	consumer.WaitDelay = waitDelay
+	consumer.Stdin = src
+
+	out, outW, err := os.Pipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	defer outW.Close()
+	consumer.Stdout = outW
+	s.out = out
+
+	if err := consumer.Start(); err != nil {
+		cancel()
+		out.Close()
+		return nil, s.processError(consumer, err)
+	}
+
+	s.wg.Add(1)
+	go s.watch(consumer)
+	return s, nil
+}
+
+// startStream pipes the stdout of the producer into the consumer and
+// starts them both, the cancel func must cancel the ctx of both
+func startStream(ctx context.Context, cancel context.CancelFunc, producer, consumer *exec.Cmd) (*Stream, error) {
+	s := &Stream{
+		producer: producer,
+		consumer: consumer,
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	producer.Stderr = &s.producerLog
+	consumer.Stderr = &s.consumerLog
+	producer.WaitDelay = waitDelay
+	consumer.WaitDelay = waitDelay
+
+	// The processes read and write the pipes directly, we close our
+	// copies of their ends once they've started so EOF is propagated
+	r, w, err := os.Pipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	defer r.Close()
+	defer w.Close()
+	out, outW, err := os.Pipe()
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	defer outW.Close()
+	producer.Stdout = w
+	consumer.Stdin = r
+	consumer.Stdout = outW
+	s.out = out
+
+	if err := consumer.Start(); err != nil {
+		cancel()
+		out.Close()
+		return nil, s.processError(consumer, err)
+	}
+	if err := producer.Start(); err != nil {
+		cancel()
+		consumer.Wait()
+		out.Close()
+		return nil, s.processError(producer, err)
+	}
+
+	s.wg.Add(2)
+	go s.watch(producer)
+	go s.watch(consumer)
+	return s, nil
+}
+
+// watch waits for the process to exit, if it fails then
+// the other process is killed since its output is useless
+func (s *Stream) watch(cmd *exec.Cmd) {
+	defer s.wg.Done()
+
+	err := cmd.Wait()
+	if err == nil {
+		return
+	}
+
+	// Only the first failure is the cause, the other process fails
+	// because it was killed. If the producer fails by itself then
+	// it's the cause even if the consumer exited first, since the
+	// consumer fails once the producer's output ends early
+	s.mu.Lock()
+	if s.err == nil && s.ctx.Err() == nil || cmd == s.producer && !wasKilled(err) {
+		s.err = s.processError(cmd, err)
+	}
+	s.mu.Unlock()
+	s.cancel()
+}
+
+// wasKilled returns whether the process exited due to a signal
+func wasKilled(err error) bool {
+	var exitErr *exec.ExitError
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == -1
+}
+
+func (s *Stream) Read(p []byte) (int, error) {
+	n, err := s.out.Read(p)
+	if err == io.EOF {
+		// The output is only complete if both processes succeeded
+		s.wg.Wait()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.err != nil {
+			return n, s.err
+		}
+		if s.ctx.Err() != nil {
+			return n, s.ctx.Err()
+		}
+	}
+	return n, err
+}
+
+// Close kills the processes if they're still running, it
+// returns the error of the process which failed if either did
+func (s *Stream) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	s.out.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Stream) processError(cmd *exec.Cmd, err error) error {
+	log := &s.consumerLog
+	if cmd == s.producer {
+		log = &s.producerLog
+	}
+	return &ProcessError{
+		Name:   cmd.Args[0],
+		Err:    err,
+		Stderr: strings.TrimSpace(log.String()),
+	}
+}
+
+// tailBuffer keeps the last maxStderr bytes written to it
+type tailBuffer struct {
+	mu sync.Mutex
+	b  []byte
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.b = append(t.b, p...)
+	if len(t.b) > maxStderr {
+		t.b = append(t.b[:0], t.b[len(t.b)-maxStderr:]...)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return string(t.b)
+}
@@ -0,0 +1,85 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// testStream pipes the output of one shell script into another
+func testStream(ctx context.Context, producer, consumer string) (*Stream, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	return startStream(ctx, cancel,
+		exec.CommandContext(ctx, "sh", "-c", producer),
+		exec.CommandContext(ctx, "sh", "-c", consumer),
+	)
+}
+
+func TestStream(t *testing.T) {
+	s, err := testStream(context.Background(), "printf hello", "tr a-z A-Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "HELLO" {
+		t.Errorf("invalid output: %q", data)
+	}
+	if err = s.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStreamFailure(t *testing.T) {
+	tests := []struct {
+		name, producer, consumer, stderr string
+	}{
+		{"producer", "printf partial; echo oops >&2; exit 3", "cat", "oops"},
+		{"consumer", "exec sleep 10", "echo bad >&2; exit 2", "bad"},
+	}
+
+	for _, tc := range tests {
+		start := time.Now()
+		s, err := testStream(context.Background(), tc.producer, tc.consumer)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The stderr of the process which failed should be reported
+		_, err = io.ReadAll(s)
+		var procErr *ProcessError
+		if !errors.As(err, &procErr) || procErr.Stderr != tc.stderr {
+			t.Errorf("%s: expected a process error but got: %v", tc.name, err)
+		}
+		if err = s.Close(); !errors.As(err, &procErr) {
+			t.Errorf("%s: expected close to return the process error but got: %v", tc.name, err)
+		}
+
+		// Both processes are torn down together
+		if time.Since(start) > 5*time.Second {
+			t.Errorf("%s: the other process wasn't killed", tc.name)
+		}
+	}
+}
+
+func TestStreamCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s, err := testStream(ctx, "exec sleep 10", "cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	_, err = io.ReadAll(s)
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the stream to be cancelled but got: %v", err)
+	}
+	if err = s.Close(); err != nil {
+		t.Error(err)
+	}
+}
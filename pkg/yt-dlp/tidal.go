@@ -0,0 +1,56 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// tidalPages is where tidal's public pages are, its api
+// needs a developer token so the pages are read instead
+const tidalPages = "https://tidal.com/browse/"
+
+// tidalResolver reads the metadata from tidal's pages and
+// then searches for the tracks on youtube
+type tidalResolver struct{}
+
+func (tidalResolver) Name() string {
+	return "tidal"
+}
+
+func (tidalResolver) Match(u *url.URL) bool {
+	switch hostname(u) {
+	case "tidal.com", "www.tidal.com", "listen.tidal.com":
+		return true
+	}
+	return false
+}
+
+func (r tidalResolver) Resolve(ctx context.Context, c *Client, u *url.URL) ([]*Track, error) {
+	return resolveInfos(ctx, c, r, u)
+}
+
+func (tidalResolver) infos(ctx context.Context, c *Client, u *url.URL) ([]trackInfo, error) {
+	kind, id, err := parseTidalLink(u)
+	if err != nil {
+		return nil, err
+	}
+	return c.pageInfos(ctx, tidalPages+kind+"/"+url.PathEscape(id))
+}
+
+// parseTidalLink returns the type and id of what the link points to,
+// links are either to the player e.g. listen.tidal.com/track/id or
+// to the public pages e.g. tidal.com/browse/track/id
+func parseTidalLink(u *url.URL) (string, string, error) {
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i := 0; i+1 < len(parts); i++ {
+		switch parts[i] {
+		case "track", "album", "playlist":
+			if parts[i+1] != "" {
+				return parts[i], parts[i+1], nil
+			}
+		}
+	}
+	return "", "", errors.New("invalid tidal link type")
+}
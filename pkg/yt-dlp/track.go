@@ -3,16 +3,25 @@ package ytdlp
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog/log"
+
+	"surf/internal/buffer"
 )
 
+// liveWindow is how much of a live stream is kept
+// in memory, it's roughly 20 minutes at 96kbps
+const liveWindow = 16 * 1024 * 1024
+
 type Track struct {
 	sync.Mutex
 
 	ID         string        `json:"id"`
+	Extractor  string        `json:"extractor_key"`
 	VideoTitle string        `json:"title"`
 	Uploader   string        `json:"uploader"`
 	Duration   time.Duration `json:"duration"`
@@ -20,11 +29,63 @@ type Track struct {
 	Title      string        `json:"track"`
 	Artist     string        `json:"artist"`
 	Album      string        `json:"album"`
+	// Live tracks are streams which never end, e.g. internet radio
+	Live bool `json:"-"`
+
+	// direct tracks are downloaded from their url without yt-dlp
+	direct bool
+	// file is the path of tracks played from the library
+	file string
+	// info is the metadata of tracks from services such as spotify
+	// which are searched for on youtube, they're placeholders until
+	// they're downloaded. query is the text tracks were searched by
+	info  *trackInfo
+	query string
+	// lookups is cancelled to stop searching for the placeholder,
+	// the download carries on if it's already been found
+	lookups context.Context
+	// substitute is played instead of the track if it can't be
+	// downloaded, it's nil if it's played itself
+	substitute atomic.Pointer[Track]
+	// logID correlates the logs of the track's download
+	logID string
+	// streamTitle is the song currently playing on a live stream,
+	// titles receives it whenever it changes
+	streamTitle atomic.Pointer[string]
+	titles      chan string
 
 	dlOnce    sync.Once
 	abortOnce sync.Once
 	abort     chan struct{}
-	oggFile   chan []byte
+	oggFile   chan *buffer.Buffer
+}
+
+// newPlaceholder is a track which is shown with the info's metadata
+// until it's found on youtube
+func newPlaceholder(info trackInfo) *Track {
+	return &Track{
+		Title:    info.Title,
+		Artist:   strings.Join(info.Artists, ", "),
+		Duration: info.Duration,
+		info:     &info,
+	}
+}
+
+// Substitute returns the track which was downloaded instead of this
+// one since it couldn't be, it's nil if the track was downloaded
+func (t *Track) Substitute() *Track {
+	return t.substitute.Load()
+}
+
+// LogID returns the id which the track's download is logged with
+func (t *Track) LogID() string {
+	t.Lock()
+	defer t.Unlock()
+
+	if t.logID == "" {
+		t.logID = newLogID()
+	}
+	return t.logID
 }
 
 func (t *Track) Abort() {
@@ -35,53 +96,126 @@ func (t *Track) Abort() {
 		return
 	}
 
-	go t.abortOnce.Do(func() {
-		defer close(t.abort)
-
-		t.abort <- struct{}{}
+	t.abortOnce.Do(func() {
+		close(t.abort)
 	})
 }
 
-func (t *Track) FileChan() <-chan []byte {
+// FileChan receives the buffer which the track is downloaded into, the
+// buffer is sent as soon as the download starts so the track can be
+// played whilst it downloads
+func (t *Track) FileChan() <-chan *buffer.Buffer {
 	return t.oggFile
 }
 
-func (t *Track) Download(c *Client) {
+// StreamTitle returns the song currently playing on a live
+// stream, it's empty if the stream hasn't told us
+func (t *Track) StreamTitle() string {
+	if title := t.streamTitle.Load(); title != nil {
+		return *title
+	}
+	return ""
+}
+
+// Titles receives the song playing on a live stream whenever it changes,
+// only the latest title is kept if it isn't received straight away
+func (t *Track) Titles() <-chan string {
+	return t.titles
+}
+
+func (t *Track) setStreamTitle(title string) {
+	if old := t.streamTitle.Swap(&title); old != nil && *old == title {
+		return
+	}
+	select {
+	case <-t.titles:
+	default:
+	}
+	select {
+	case t.titles <- title:
+	default:
+	}
+}
+
+// Download starts downloading the track in the background if it hasn't
+// been already, the lookups ctx stops the search for placeholders, e.g.
+// once they're cleared from the queue
+func (t *Track) Download(lookups context.Context, c *Client) {
 	t.Lock()
 	defer t.Unlock()
+	if t.lookups == nil {
+		t.lookups = lookups
+	}
 
 	go t.dlOnce.Do(func() {
 		t.abort = make(chan struct{})
-		t.oggFile = make(chan []byte)
+		t.oggFile = make(chan *buffer.Buffer)
+		t.titles = make(chan string, 1)
 		defer close(t.oggFile)
 
-		tLog := log.With().Str("track", t.Pretty()).Logger()
-
-		// Download track
-		tLog.Trace().Msg("starting to download")
-		audio, err := c.DownloadFile(context.Background(), t.URL)
-		if err != nil {
-			tLog.Error().Err(err).Msg("failed to download file")
-			select {
-			case t.oggFile <- nil:
-				tLog.Trace().Msg("sent nil track")
-			case <-t.abort:
-				tLog.Trace().Msg("aborted while waiting to send nil track")
-			}
-			return
+		tLog := log.With().Str("id", t.LogID()).Str("track", t.Pretty()).Logger()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		// Only the most recent part of live streams is kept
+		var buf *buffer.Buffer
+		if t.Live {
+			buf = buffer.NewWindow(liveWindow)
+		} else {
+			buf = buffer.New()
+		}
+		done := make(chan struct{})
+		download := func() {
+			tLog.Trace().Msg("starting to download")
+			go func() {
+				defer close(done)
+
+				err := c.downloadRetrying(ctx, t, buf)
+				if err != nil {
+					tLog.Error().Err(err).Msg("failed to download file")
+				} else {
+					tLog.Trace().Msg("successfully downloaded")
+				}
+				buf.CloseWithError(err)
+			}()
+		}
+
+		// Live streams are only downloaded once they're played
+		// since we'd otherwise be buffering a stream no one hears
+		if !t.Live {
+			download()
 		}
-		tLog.Trace().Msg("successfully downloaded")
 
 		// Send track to
 		select {
-		case t.oggFile <- audio:
-			tLog.Trace().Msg("sent downloaded track")
+		case t.oggFile <- buf:
+			tLog.Trace().Msg("sent downloading track")
 		case <-t.abort:
 			tLog.Trace().Msg("aborted while waiting to send track")
+			return
+		}
+		if t.Live {
+			download()
+		}
+
+		// The track can still be aborted whilst it's playing
+		select {
+		case <-done:
+		case <-t.abort:
+			tLog.Trace().Msg("aborted while downloading track")
 		}
 	})
 }
 
+// cacheKey identifies the track in the cache, it's
+// empty if we don't know enough to identify the track
+func (t *Track) cacheKey() string {
+	if t.Extractor == "" || t.ID == "" {
+		return ""
+	}
+	return strings.ToLower(t.Extractor) + "-" + t.ID
+}
+
 func (t *Track) Pretty() string {
 	if t.Title != "" {
 		return fmt.Sprintf("`%s` - `%s`", t.Artist, t.Title)